@@ -0,0 +1,227 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// sketchRelativeAccuracy of the runtimes estimated by the quantile sketch
+const sketchRelativeAccuracy = 0.01
+
+// quantileSketch estimates quantiles of runtimes in memory which only grows with the
+// logarithm of the range of the runtimes. Runtimes are counted in logarithmically sized
+// bins, so that each estimate is within sketchRelativeAccuracy of the true runtime.
+type quantileSketch struct {
+	gamma    float64
+	logGamma float64
+	bins     map[int]int
+	count    int
+	min, max time.Duration
+}
+
+func newQuantileSketch() *quantileSketch {
+	gamma := (1 + sketchRelativeAccuracy) / (1 - sketchRelativeAccuracy)
+	return &quantileSketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		bins:     make(map[int]int),
+	}
+}
+
+func (qs *quantileSketch) add(d time.Duration) {
+	if qs.count == 0 || d < qs.min {
+		qs.min = d
+	}
+	if qs.count == 0 || d > qs.max {
+		qs.max = d
+	}
+	qs.count++
+	qs.bins[qs.binOf(d)]++
+}
+
+func (qs *quantileSketch) binOf(d time.Duration) int {
+	return int(math.Ceil(math.Log(float64(max(d, 1))) / qs.logGamma))
+}
+
+// valueOf the bin, within the relative accuracy of every runtime in it
+func (qs *quantileSketch) valueOf(bin int) time.Duration {
+	v := time.Duration(2 * math.Pow(qs.gamma, float64(bin)) / (qs.gamma + 1))
+	return min(max(v, qs.min), qs.max)
+}
+
+// sortedBins of the sketch, in increasing order of runtime
+func (qs *quantileSketch) sortedBins() []int {
+	bins := make([]int, 0, len(qs.bins))
+	for bin := range qs.bins {
+		bins = append(bins, bin)
+	}
+	slices.Sort(bins)
+	return bins
+}
+
+// percentiles estimated by the sketch, using the nearest rank
+func (qs *quantileSketch) percentiles() []percentile {
+	if qs.count == 0 {
+		return nil
+	}
+	bins := qs.sortedBins()
+	ret := make([]percentile, 0, len(reportedPercentiles))
+	for _, p := range reportedPercentiles {
+		rank := max(int(math.Ceil(p*float64(qs.count)/100-1e-9)), 1)
+		seen := 0
+		for _, bin := range bins {
+			seen += qs.bins[bin]
+			if seen >= rank {
+				ret = append(ret, percentile{Percent: p, Runtime: qs.valueOf(bin)})
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// histogram of equally wide buckets between the min and max runtime, estimated by
+// counting each bin of the sketch into the bucket of its value
+func (qs *quantileSketch) histogram(amBuckets int) []histogramBucket {
+	if qs.count == 0 {
+		return nil
+	}
+	buckets := equalWidthBuckets(qs.min, qs.max, amBuckets)
+	for bin, count := range qs.bins {
+		buckets[bucketIdxOf(buckets, qs.valueOf(bin))].Count += count
+	}
+	return buckets
+}
+
+// aggregator accumulates the statistics of results one at a time, in constant memory.
+// Runtime percentiles and equally wide histogram buckets are estimated.
+type aggregator struct {
+	retry         retryPolicy
+	histogramSpec histogramSpec
+	amDone        int
+	amFails       int
+	amCancelled   int
+	amTimeouts    int
+	amRetried     int
+	amFailedTasks int
+	// amSuccess, mean and m2 are the running count, mean and sum of squared differences
+	// from the mean of the successful runtimes, as by Welford's algorithm
+	amSuccess int
+	mean      float64
+	m2        float64
+	total     time.Duration
+	min, max  Result
+	sketch    *quantileSketch
+	// boundedHistogram is counted exactly when the histogram has explicit bounds
+	boundedHistogram []histogramBucket
+	resources        resourceAccumulator
+}
+
+func newAggregator(retry retryPolicy, hs histogramSpec) *aggregator {
+	a := &aggregator{
+		retry:         retry,
+		histogramSpec: hs,
+		sketch:        newQuantileSketch(),
+		resources:     resourceAccumulator{cpuSketch: newQuantileSketch()},
+	}
+	if len(hs.bounds) > 0 {
+		a.boundedHistogram = boundedBuckets(hs.bounds)
+	}
+	return a
+}
+
+// add the result to the statistics, same as calcResultStats counts it
+func (a *aggregator) add(r Result) {
+	a.amDone++
+	// Every task which needed a retry has exactly one second attempt
+	if r.Attempt == 2 {
+		a.amRetried++
+	}
+	if r.isFailure() && !a.retry.shouldRetry(r.Attempt) {
+		a.amFailedTasks++
+	}
+	a.resources.add(r)
+	switch {
+	case r.IsCancelled:
+		a.amCancelled++
+		return
+	case r.IsTimeout:
+		a.amTimeouts++
+		return
+	case r.IsError:
+		a.amFails++
+		return
+	}
+	if a.amSuccess == 0 || r.Runtime < a.min.Runtime {
+		a.min = withoutOutput(r)
+	}
+	if a.amSuccess == 0 || r.Runtime > a.max.Runtime {
+		a.max = withoutOutput(r)
+	}
+	a.amSuccess++
+	a.total += r.Runtime
+	delta := float64(r.Runtime) - a.mean
+	a.mean += delta / float64(a.amSuccess)
+	a.m2 += delta * (float64(r.Runtime) - a.mean)
+	a.sketch.add(r.Runtime)
+	if a.boundedHistogram != nil {
+		a.boundedHistogram[bucketIdxOf(a.boundedHistogram, r.Runtime)].Count++
+	}
+}
+
+// amFailedAttempts which either errored or timed out
+func (a *aggregator) amFailedAttempts() int {
+	return a.amFails + a.amTimeouts
+}
+
+// statistics of the added results, out of am requested tasks
+func (a *aggregator) statistics(am int) statistics {
+	if a.amDone == 0 {
+		return statistics{am: am}
+	}
+	stdDev := time.Duration(0)
+	if a.amSuccess > 0 {
+		stdDev = time.Duration(math.Sqrt(a.m2 / float64(a.amSuccess)))
+	}
+	amExhausted := 0
+	if a.retry.enabled() {
+		amExhausted = a.amFailedTasks
+	}
+	histogram := a.boundedHistogram
+	if histogram == nil {
+		histogram = a.sketch.histogram(a.histogramSpec.amBuckets)
+	} else if a.amSuccess == 0 {
+		histogram = nil
+	}
+	return statistics{
+		am:            am,
+		amDone:        a.amDone,
+		amFails:       a.amFails,
+		amCancelled:   a.amCancelled,
+		amTimeouts:    a.amTimeouts,
+		amRetried:     a.amRetried,
+		amExhausted:   amExhausted,
+		amFailedTasks: a.amFailedTasks,
+		retries:       a.retry.enabled(),
+		min:           a.min,
+		max:           a.max,
+		total:         a.total,
+		average:       time.Duration(a.mean),
+		stdDev:        stdDev,
+		percentiles:   a.sketch.percentiles(),
+		histogram:     slices.Clone(histogram),
+		resources:     a.resources.stats(),
+		estimated:     true,
+	}
+}
+
+// withoutOutput returns the result without its output, so that it may be kept without
+// growing the memory
+func withoutOutput(r Result) Result {
+	r.Output = ""
+	r.Stdout = nil
+	r.Stderr = nil
+	r.taggedOutput = ""
+	return r
+}
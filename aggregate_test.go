@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_quantileSketch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	qs := newQuantileSketch()
+	runtimes := make([]time.Duration, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		d := time.Duration(r.ExpFloat64() * float64(10*time.Millisecond))
+		runtimes = append(runtimes, d)
+		qs.add(d)
+	}
+	want := calcPercentiles(sortedRuntimes(resultsOf(runtimes)))
+	got := qs.percentiles()
+	for i := range want {
+		relErr := math.Abs(float64(got[i].Runtime-want[i].Runtime)) / float64(want[i].Runtime)
+		if relErr > sketchRelativeAccuracy {
+			t.Fatalf("expected p%v: %v, within %v, got: %v", want[i].Percent, want[i].Runtime, sketchRelativeAccuracy, got[i].Runtime)
+		}
+	}
+	if len(qs.bins) > 2000 {
+		t.Fatalf("expected bins to grow with the logarithm of the range, got: %v bins", len(qs.bins))
+	}
+	total := 0
+	for _, b := range qs.histogram(10) {
+		total += b.Count
+	}
+	if total != len(runtimes) {
+		t.Fatalf("expected histogram to count: %v runtimes, got: %v", len(runtimes), total)
+	}
+}
+
+func resultsOf(runtimes []time.Duration) []Result {
+	ret := make([]Result, 0, len(runtimes))
+	for i, d := range runtimes {
+		ret = append(ret, Result{Idx: i, Attempt: 1, Runtime: d})
+	}
+	return ret
+}
+
+func Test_aggregator(t *testing.T) {
+	results := []Result{
+		{Idx: 0, Attempt: 1, Runtime: 10 * time.Millisecond, Output: "a"},
+		{Idx: 1, Attempt: 1, Runtime: 40 * time.Millisecond, IsError: true},
+		{Idx: 1, Attempt: 2, Runtime: 20 * time.Millisecond, Output: "b"},
+		{Idx: 2, Attempt: 1, Runtime: 30 * time.Millisecond, Output: "c"},
+		{Idx: 3, Attempt: 1, Runtime: 50 * time.Millisecond, IsTimeout: true},
+		{Idx: 4, Attempt: 1, Runtime: 60 * time.Millisecond, IsCancelled: true},
+	}
+	retry := retryPolicy{maxAttempts: 2}
+	hs := histogramSpec{bounds: []time.Duration{15 * time.Millisecond}}
+	agg := newAggregator(retry, hs)
+	for _, r := range results {
+		agg.add(r)
+	}
+	got := agg.statistics(5)
+	c := configuredOper{retry: retry, histogram: hs}
+	want := c.calcResultStats(results, 5)
+
+	if got.amDone != want.amDone || got.amFails != want.amFails || got.amTimeouts != want.amTimeouts ||
+		got.amCancelled != want.amCancelled || got.amRetried != want.amRetried || got.amFailedTasks != want.amFailedTasks {
+		t.Fatalf("expected counts of: %+v, got: %+v", want, got)
+	}
+	if got.min.Idx != 0 || got.max.Idx != 2 || got.min.Output != "" {
+		t.Fatalf("expected min and max without output, got min: %+v, max: %+v", got.min, got.max)
+	}
+	if got.total != want.total || got.average != want.average || math.Abs(float64(got.stdDev-want.stdDev)) > float64(time.Microsecond) {
+		t.Fatalf("expected total: %v, average: %v, std deviation: %v, got total: %v, average: %v, std deviation: %v",
+			want.total, want.average, want.stdDev, got.total, got.average, got.stdDev)
+	}
+	if got.total != 60*time.Millisecond || got.average != 20*time.Millisecond {
+		t.Fatalf("expected total: 60ms, average: 20ms, got total: %v, average: %v", got.total, got.average)
+	}
+	// Population standard deviation of 10ms, 20ms and 30ms
+	if wantStdDev := time.Duration(math.Sqrt(200.0/3) * float64(time.Millisecond)); math.Abs(float64(got.stdDev-wantStdDev)) > float64(time.Microsecond) {
+		t.Fatalf("expected std deviation: %v, got: %v", wantStdDev, got.stdDev)
+	}
+	if got.histogram[0].Count != 1 || got.histogram[1].Count != 2 {
+		t.Fatalf("expected exact counts with bounds, got: %v", got.histogram)
+	}
+	if !got.estimated {
+		t.Fatal("expected statistics to be marked as estimated")
+	}
+}
+
+func Test_configuredOper_run_lowMemory(t *testing.T) {
+	c := configuredOper{
+		am:            5,
+		args:          []string{"printf", "output"},
+		lowMemory:     true,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if len(c.results) != 0 || len(stats.Results) != 0 {
+		t.Fatalf("expected no results to be kept, got: %v", len(c.results))
+	}
+	if stats.amDone != 5 || len(stats.percentiles) == 0 {
+		t.Fatalf("expected aggregated statistics of 5 tasks, got: %+v", stats)
+	}
+}
+
+func Test_configuredOper_calcStats_lowMemoryMatchesDefault(t *testing.T) {
+	// Every third task fails, and the runtimes of the successful tasks vary
+	c := configuredOper{
+		am:            9,
+		args:          []string{"sh", "-c", `[ $((REPEATER_TASK_IDX % 3)) -eq 0 ] && exit 1; sleep 0.0$REPEATER_TASK_IDX`},
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	def := c.run(context.Background())
+	// The aggregator is fed in both modes, so the same results give the low memory statistics
+	c.lowMemory = true
+	low := c.calcStats()
+
+	if def.amDone != 9 || def.amFails != 3 {
+		t.Fatalf("expected 9 tasks of which 3 failed, got: %v, %v", def.amDone, def.amFails)
+	}
+	if low.amDone != def.amDone || low.amFails != def.amFails || low.amFailedTasks != def.amFailedTasks {
+		t.Fatalf("expected counts of: %+v, got: %+v", def, low)
+	}
+	if low.total != def.total || low.min.Runtime != def.min.Runtime || low.max.Runtime != def.max.Runtime {
+		t.Fatalf("expected total: %v, min: %v, max: %v, got total: %v, min: %v, max: %v",
+			def.total, def.min.Runtime, def.max.Runtime, low.total, low.min.Runtime, low.max.Runtime)
+	}
+	if math.Abs(float64(low.average-def.average)) > float64(time.Microsecond) ||
+		math.Abs(float64(low.stdDev-def.stdDev)) > float64(time.Microsecond) {
+		t.Fatalf("expected average: %v, std deviation: %v, got average: %v, std deviation: %v",
+			def.average, def.stdDev, low.average, low.stdDev)
+	}
+}
+
+func Test_configuredOper_New_lowMemory(t *testing.T) {
+	resultFile := t.TempDir() + "/results"
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, resultFile, false, false, runOptions{lowMemory: true})
+	if err == nil {
+		t.Fatal("expected error as results aren't kept for a json result file, got nil")
+	}
+	_, err = New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, resultFile, false, false, runOptions{lowMemory: true, resultFormat: resultFormatJSONL})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+}
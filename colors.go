@@ -12,6 +12,9 @@ const (
 	RED colorCode = iota + 31
 	GREEN
 	YELLOW
+	BLUE
+	MAGENTA
+	CYAN
 )
 
 var useColor = os.Getenv("NO_COLOR") != "true"
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/baalimago/repeater/internal/output"
@@ -39,6 +42,158 @@ type configuredOper struct {
 	totalRuntime          time.Duration
 	hideOutputOnSuccess   bool
 	wasCancelled          bool
+	rate                  float64
+	limiter               *rateLimiter
+	amDispatched          int
+	duration              time.Duration
+	deadline              time.Time
+	timeout               time.Duration
+	retry                 retryPolicy
+	halt                  haltPolicy
+	haltReason            string
+	amHaltFails           int
+	amHaltFinished        int
+	cancelWork            context.CancelFunc
+	lines                 []string
+	params                *paramTable
+	argTemplates          []*template.Template
+	seed                  int64
+	runID                 string
+	env                   []envVar
+	envTemplates          []*template.Template
+	shell                 bool
+	resultFormat          string
+	histogram             histogramSpec
+	statisticsFormat      string
+	lowMemory             bool
+	agg                   *aggregator
+	combinationAggs       []*aggregator
+	outputLimit           outputLimit
+	outputDirTemplate     *template.Template
+	outputDirMeta         bool
+	tagTemplate           *template.Template
+	tagColor              bool
+	keepOrder             bool
+	keepOrderBuffer       int
+	orderedOutput         *orderedOutput
+	success               *successCriteria
+	hunt                  *hunter
+	outputGroups          *outputGrouper
+	normalizer            outputNormalizer
+}
+
+// runOptions contains the configuration which extends the core repetition
+// settings of New. The zero value disables every option.
+type runOptions struct {
+	// rate at which tasks are dispatched, such as '50/s'. Empty means unlimited.
+	rate string
+	// duration to keep dispatching tasks for, instead of a fixed amount
+	duration time.Duration
+	// until is a RFC3339 timestamp to keep dispatching tasks until, instead of
+	// a fixed amount
+	until string
+	// timeout of each task, after which the task is killed. 0 means no timeout.
+	timeout time.Duration
+	// maxAttempts of each task, including the first one. Failed tasks are retried
+	// on the same task index. If retryOnFail is set and this is at most 1, tasks
+	// are retried until they succeed.
+	maxAttempts int
+	// backoff strategy between attempts, one of ['const', 'linear', 'exp']
+	backoff string
+	// backoffBase is the delay which the backoff strategy is based on
+	backoffBase time.Duration
+	// backoffJitter is the fraction, [0, 1], which backoff delays are randomly adjusted by
+	backoffJitter float64
+	// halt policy on the format '<soon|now>,fail=<amount|percentage%>', such as 'now,fail=1'
+	halt string
+	// input is a path to a file where each line is the input of one task, '-' for stdin.
+	// If am is 0, it's set to the amount of lines.
+	input string
+	// params is a path to a csv, or tsv, file where the header row names the parameters
+	// and each following row is the parameters of one task. If am is 0, it's set to
+	// the amount of rows.
+	params string
+	// paramsCycle through the rows of params when they run out, instead of stopping
+	paramsCycle bool
+	// matrix of parameters on the format '<name>=<value>,<value>,...'. Each combination
+	// of the parameters is repeated am times.
+	matrix []string
+	// template enables expansion of the arguments as text/template, such as '{{.Idx}}'
+	template bool
+	// seed of the random values available to templates. 0 picks a seed based on the time.
+	seed int64
+	// env of the commands on the format 'KEY=VALUE', in addition to the environment of
+	// repeater and the metadata of the task. Values may contain the same placeholders as
+	// the arguments.
+	env []string
+	// shell mode joins the arguments into one command line which is run by shellCommand.
+	// Substituted values are quoted for the shell.
+	shell bool
+	// shellCommand which the command line is appended to, such as '/bin/sh -c'. Empty
+	// means DefaultShellCommand.
+	shellCommand string
+	// dryRun validates the configuration without creating any files, so that the
+	// tasks may be printed instead of run
+	dryRun bool
+	// resultFormat of the result file, one of ['json', 'jsonl']. Empty means 'json'.
+	resultFormat string
+	// histogramBuckets of the statistics, either an amount of equally wide buckets, such
+	// as '10', or bounds, such as '10ms,50ms,1s'. Empty means the default amount.
+	histogramBuckets string
+	// statisticsFormat is one of ['text', 'json']. Empty means 'text'.
+	statisticsFormat string
+	// lowMemory disables keeping the results in memory. Statistics are only aggregated,
+	// with estimated percentiles.
+	lowMemory bool
+	// maxOutput of each task, such as '64KiB'. Empty means unlimited.
+	maxOutput string
+	// maxOutputKeep is the part of the output to keep when it exceeds maxOutput, one of
+	// ['head', 'tail', 'both']. Empty means 'both'.
+	maxOutputKeep string
+	// outputSpillDir is where the full output of tasks exceeding maxOutput is written
+	outputSpillDir string
+	// outputDir of each task, where its stdout and stderr are written to separate files.
+	// It may contain the same placeholders as the arguments, such as './runs/{{.Idx}}'.
+	outputDir string
+	// outputDirMeta writes the result of each task as metadata to its outputDir
+	outputDirMeta bool
+	// tag prefixes each output line with tagFormat, so that the task of each line may be told apart
+	tag bool
+	// tagFormat is a template of the tag, such as '[w{{.WorkerID}} #{{.Idx}}]'. Empty means
+	// DefaultTagFormat.
+	tagFormat string
+	// tagColor colors the tag by worker
+	tagColor bool
+	// keepOrder writes the output of the tasks in task index order, instead of as they finish
+	keepOrder bool
+	// keepOrderBuffer is the amount of tasks whose output is kept in memory while waiting
+	// for an earlier task, beyond which it spills to disk. 0 means DefaultKeepOrderBuffer.
+	keepOrderBuffer int
+	// okExit codes of successful attempts, such as '0,2'. Empty means only 0.
+	okExit string
+	// okStdoutMatch is a regex which the stdout of successful attempts must match
+	okStdoutMatch string
+	// okStdoutNotMatch is a regex which the stdout of successful attempts must not match
+	okStdoutNotMatch string
+	// okStderrEmpty requires the stderr of successful attempts to be empty
+	okStderrEmpty bool
+	// okMaxRuntime of successful attempts. 0 means no limit.
+	okMaxRuntime time.Duration
+	// okMode combines the success rules, one of ['all', 'any']. Empty means 'all'.
+	okMode string
+	// hunt runs until the first failed attempt, then stops and saves it to a reproducer
+	// bundle in huntDir
+	hunt bool
+	// huntOutput also stops the hunt at the first successful attempt whose output differs
+	// from the first successful one
+	huntOutput bool
+	// huntDir of the reproducer bundle. Empty means 'repeater-hunt-<run id>'.
+	huntDir string
+	// groupOutputs counts the distinct outputs, and shows how each differs from the most
+	// common one
+	groupOutputs bool
+	// normalize rules of the outputs before they're grouped or hunted
+	normalize []string
 }
 
 type userQuitError string
@@ -54,6 +209,13 @@ const (
 	outputFormatV2 = "v2"
 )
 
+const (
+	// resultFormatJSON writes every result as one json array once the run is done
+	resultFormatJSON = "json"
+	// resultFormatJSONL appends one json object per line as soon as each task is done
+	resultFormatJSONL = "jsonl"
+)
+
 type incrementConfigError struct {
 	args []string
 }
@@ -74,20 +236,275 @@ func New(am, workers int,
 	resultFlag string,
 	retryOnFail bool,
 	hideOutputOnSuccess bool,
+	opts runOptions,
 ) (configuredOper, error) {
+	// Collect every problem with the configuration, so that they may be fixed at once
+	var errs []error
 	shouldHaveReportFile := pMode == output.BOTH || pMode == output.FILE ||
 		oMode == output.BOTH || oMode == output.FILE
 
 	if shouldHaveReportFile && outputFile == "" {
-		return configuredOper{}, fmt.Errorf("progress mode '%v', or output mode '%v', requires a report file but none is set. Use flag --file <file_name>", pMode, oMode)
+		errs = append(errs, fmt.Errorf("progress mode '%v', or output mode '%v', requires a report file but none is set. Use flag --file <file_name>", pMode, oMode))
+	}
+
+	env, err := parseEnv(opts.env)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if increment && !containsIncrementPlaceholder(args) && !containsIncrementPlaceholder(envValues(env)) {
+		errs = append(errs, incrementConfigError{args: args})
+	}
+
+	if opts.shell {
+		shellCommand := opts.shellCommand
+		if shellCommand == "" {
+			shellCommand = DefaultShellCommand
+		}
+		shellArgs, err := parseShellCommand(shellCommand)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			args = append(shellArgs, strings.Join(args, " "))
+		}
+	}
+
+	timeBounded := opts.duration != 0 || opts.until != ""
+	var lines []string
+	// Reading the input from stdin consumes it, so that the user can't be asked what to do
+	// with files which already exist
+	stdinConflict := false
+	if opts.input == stdinInput && outputFileMode == "" {
+		for _, path := range []string{outputFile, resultFlag} {
+			if _, statErr := os.Stat(path); path != "" && statErr == nil {
+				stdinConflict = true
+				errs = append(errs, fmt.Errorf("file: %v, already exists, and can't be asked about as input is read from stdin, set fileMode to 't'runcate or 'a'ppend", path))
+			}
+		}
+	}
+	if opts.input != "" && !stdinConflict {
+		if timeBounded {
+			errs = append(errs, errors.New("input can't be combined with duration or until, as the amount of tasks is decided by the amount of lines"))
+		}
+		lines, err = readInputLines(opts.input)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("failed to read input: %w", err))
+		case len(lines) == 0:
+			errs = append(errs, fmt.Errorf("input: %v, has no lines", opts.input))
+			lines = nil
+		default:
+			if am == 0 {
+				am = len(lines)
+			}
+			if am > len(lines) {
+				errs = append(errs, fmt.Errorf("input: %v, has %v lines, which is fewer than the requested amount of repetitions: %v", opts.input, len(lines), am))
+			}
+		}
+	}
+
+	var params *paramTable
+	if opts.params != "" {
+		if opts.input != "" {
+			errs = append(errs, errors.New("input and params are mutually exclusive, please set only one of them"))
+		}
+		if timeBounded && !opts.paramsCycle {
+			errs = append(errs, errors.New("params can only be combined with duration or until if paramsCycle is set"))
+		}
+		params, err = readParamTable(opts.params, opts.paramsCycle)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read params: %w", err))
+		} else {
+			if am == 0 {
+				am = len(params.rows)
+			}
+			// Stop when the rows run out
+			if !params.cycle && am > len(params.rows) {
+				am = len(params.rows)
+			}
+		}
+	}
+
+	if len(opts.matrix) > 0 {
+		if opts.input != "" || opts.params != "" {
+			errs = append(errs, errors.New("matrix can't be combined with input or params"))
+		}
+		if timeBounded {
+			errs = append(errs, errors.New("matrix can't be combined with duration or until, as each combination is repeated a fixed amount of times"))
+		}
+		params, err = parseMatrix(opts.matrix, am)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse matrix: %w", err))
+		} else {
+			am *= len(params.rows)
+		}
+	}
+
+	var argTemplates, envTemplates []*template.Template
+	if opts.template {
+		argTemplates, err = parseArgTemplates(args[1:], params, opts.shell)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		envTemplates, err = parseEnvTemplates(env, params)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	seed := opts.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	if workers > am && !timeBounded {
+		errs = append(errs, fmt.Errorf("please use less workers than repetitions. Am workers: %v, am repetitions: %v", workers, am))
+	}
+
+	if opts.duration != 0 && opts.until != "" {
+		errs = append(errs, errors.New("duration and until are mutually exclusive, please set only one of them"))
+	}
+
+	if opts.duration < 0 {
+		errs = append(errs, fmt.Errorf("duration must be positive, got: %v", opts.duration))
+	}
+
+	if opts.timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout must be positive, got: %v", opts.timeout))
+	}
+
+	if opts.maxAttempts < 0 {
+		errs = append(errs, fmt.Errorf("maxAttempts must be positive, got: %v. Use retryOnFail to retry until success", opts.maxAttempts))
+	}
+
+	backoff, err := parseBackoff(opts.backoff)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if opts.backoffBase < 0 {
+		errs = append(errs, fmt.Errorf("backoffBase must be positive, got: %v", opts.backoffBase))
+	}
+
+	if opts.backoffJitter < 0 || opts.backoffJitter > 1 {
+		errs = append(errs, fmt.Errorf("backoffJitter must be within [0, 1], got: %v", opts.backoffJitter))
+	}
+
+	retry := retryPolicy{
+		maxAttempts: opts.maxAttempts,
+		backoff:     backoff,
+		base:        opts.backoffBase,
+		jitter:      opts.backoffJitter,
+	}
+	if retryOnFail && opts.maxAttempts <= 1 {
+		retry.maxAttempts = unlimitedAttempts
+	}
+
+	halt, err := parseHalt(opts.halt)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	var deadline time.Time
+	if opts.until != "" {
+		deadline, err = time.Parse(time.RFC3339, opts.until)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse until, expected RFC3339 format: %w", err))
+		} else if deadline.Before(time.Now()) {
+			errs = append(errs, fmt.Errorf("until: %v, has already passed", opts.until))
+		}
+	}
+
+	rate, err := parseRate(opts.rate)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to parse rate: %w", err))
+	}
+
+	resultFormat := opts.resultFormat
+	if resultFormat == "" {
+		resultFormat = resultFormatJSON
+	}
+	if resultFormat != resultFormatJSON && resultFormat != resultFormatJSONL {
+		errs = append(errs, fmt.Errorf("unrecognized result format: %q, options are: ['%v', '%v']", resultFormat, resultFormatJSON, resultFormatJSONL))
+	}
+
+	histogram, err := parseHistogramBuckets(opts.histogramBuckets)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	statisticsFormat := opts.statisticsFormat
+	if statisticsFormat == "" {
+		statisticsFormat = statisticsFormatText
+	}
+	if statisticsFormat != statisticsFormatText && statisticsFormat != statisticsFormatJSON {
+		errs = append(errs, fmt.Errorf("unrecognized statistics format: %q, options are: ['%v', '%v']", statisticsFormat, statisticsFormatText, statisticsFormatJSON))
+	}
+
+	maxOutput, err := parseByteSize(opts.maxOutput)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to parse maxOutput: %w", err))
+	}
+	keep, err := parseOutputKeep(opts.maxOutputKeep)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if opts.outputSpillDir != "" && maxOutput == 0 {
+		errs = append(errs, errors.New("outputSpillDir requires maxOutput to be set, as only the full output of truncated tasks is written"))
 	}
 
-	if increment && !containsIncrementPlaceholder(args) {
-		return configuredOper{}, incrementConfigError{args: args}
+	var outputDirTemplate *template.Template
+	if opts.outputDir != "" {
+		outputDirTemplate, err = parseOutputDirTemplate(opts.outputDir, params)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	} else if opts.outputDirMeta {
+		errs = append(errs, errors.New("outputDirMeta requires outputDir to be set"))
 	}
 
-	if workers > am {
-		return configuredOper{}, fmt.Errorf("please use less workers than repetitions. Am workers: %v, am repetitions: %v", workers, am)
+	var tagTemplate *template.Template
+	if opts.tag {
+		if outFormat == outputFormatV2 {
+			errs = append(errs, fmt.Errorf("tag requires output format '%v', as output format '%v' already separates the output of each task by stream", outputFormatV1, outputFormatV2))
+		}
+		tagFormat := opts.tagFormat
+		if tagFormat == "" {
+			tagFormat = DefaultTagFormat
+		}
+		tagTemplate, err = parseTagTemplate(tagFormat, params)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	keepOrderBuffer := opts.keepOrderBuffer
+	if keepOrderBuffer == 0 {
+		keepOrderBuffer = DefaultKeepOrderBuffer
+	}
+	if keepOrderBuffer < 0 {
+		errs = append(errs, fmt.Errorf("keepOrderBuffer must be positive, got: %v", keepOrderBuffer))
+	}
+
+	success, err := parseSuccessCriteria(opts.okExit, opts.okStdoutMatch, opts.okStdoutNotMatch, opts.okStderrEmpty, opts.okMaxRuntime, opts.okMode)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	if !opts.hunt && (opts.huntOutput || opts.huntDir != "") {
+		errs = append(errs, errors.New("huntOutput and huntDir require hunt to be set"))
+	}
+
+	normalizer, err := parseNormalizeRules(opts.normalize)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(opts.normalize) > 0 && !opts.groupOutputs && !opts.huntOutput {
+		errs = append(errs, errors.New("normalize requires groupOutputs or huntOutput to be set, as only those compare outputs"))
+	}
+
+	if opts.lowMemory && resultFlag != "" && resultFormat != resultFormatJSONL {
+		errs = append(errs, fmt.Errorf("lowMemory requires result format '%v' to write the result file, as the results aren't kept", resultFormatJSONL))
 	}
 
 	c := configuredOper{
@@ -106,10 +523,89 @@ func New(am, workers int,
 		workPlanMu:          &sync.Mutex{},
 		retryOnFail:         retryOnFail,
 		hideOutputOnSuccess: hideOutputOnSuccess,
+		rate:                rate,
+		duration:            opts.duration,
+		deadline:            deadline,
+		timeout:             opts.timeout,
+		retry:               retry,
+		halt:                halt,
+		lines:               lines,
+		params:              params,
+		argTemplates:        argTemplates,
+		seed:                seed,
+		runID:               newRunID(),
+		env:                 env,
+		envTemplates:        envTemplates,
+		shell:               opts.shell,
+		resultFormat:        resultFormat,
+		histogram:           histogram,
+		statisticsFormat:    statisticsFormat,
+		lowMemory:           opts.lowMemory,
+		outputLimit: outputLimit{
+			maxBytes: maxOutput,
+			keep:     keep,
+			spillDir: opts.outputSpillDir,
+		},
+		outputDirTemplate: outputDirTemplate,
+		outputDirMeta:     opts.outputDirMeta,
+		tagTemplate:       tagTemplate,
+		tagColor:          opts.tagColor,
+		keepOrder:         opts.keepOrder,
+		keepOrderBuffer:   keepOrderBuffer,
+		success:           success,
+		normalizer:        normalizer,
+	}
+	if rate > 0 {
+		c.limiter = newRateLimiter(rate)
+	}
+	if opts.groupOutputs {
+		c.outputGroups = newOutputGrouper(c.normalizer)
+	}
+	if opts.hunt {
+		c.hunt = &hunter{dir: opts.huntDir, diffOutput: opts.huntOutput, normalizer: c.normalizer}
+		if c.hunt.dir == "" {
+			c.hunt.dir = "repeater-hunt-" + c.runID
+		}
+	}
+
+	// Catch errors which only show on execution, such as references to unknown fields.
+	// Skipped if the input or params failed to load, as every reference to them would fail.
+	missingData := (opts.input != "" && lines == nil) || ((opts.params != "" || len(opts.matrix) > 0) && params == nil)
+	if !missingData {
+		if _, err := c.executeArgTemplates(0, 0, 1); err != nil {
+			errs = append(errs, err)
+		}
+		if _, err := c.taskEnv(0, 0, 1); err != nil {
+			errs = append(errs, err)
+		}
+		if c.outputDirTemplate != nil {
+			if _, err := c.taskOutputDir(0, 0, 1); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if c.tagTemplate != nil {
+			if _, err := c.taskTag(0, 0, 1); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return configuredOper{}, errors.Join(errs...)
 	}
 
 	c.workerWg.Add(workers)
 
+	// Don't touch any files when only planning the run
+	if opts.dryRun {
+		return c, nil
+	}
+
+	if opts.outputSpillDir != "" {
+		if err := os.MkdirAll(opts.outputSpillDir, 0o755); err != nil {
+			return c, fmt.Errorf("failed to create outputSpillDir: %w", err)
+		}
+	}
+
 	file, err := c.getFile(outputFile, outputFileMode)
 	if err != nil {
 		if errors.Is(err, UserQuitError) {
@@ -119,7 +615,7 @@ func New(am, workers int,
 	}
 	c.outputFile = file
 
-	file, err = c.getFile(resultFlag, "")
+	file, err = c.getFile(resultFlag, outputFileMode)
 	if err != nil {
 		if errors.Is(err, UserQuitError) {
 			return c, err
@@ -164,6 +660,12 @@ func (c *configuredOper) String() string {
 	if c.outputFile != nil {
 		reportFileName = c.outputFile.Name()
 	}
+	am := fmt.Sprintf("%v", c.am)
+	if c.duration > 0 {
+		am = fmt.Sprintf("for %v", c.duration)
+	} else if !c.deadline.IsZero() {
+		am = fmt.Sprintf("until %v", c.deadline.Format(time.RFC3339))
+	}
 	return fmt.Sprintf(`am: %v
 command: %v
 increment: %v
@@ -172,18 +674,62 @@ progress: %s
 progress format: %q
 output: %s
 report file: %v
-report file mode: %v`, c.am, c.args, c.increment, c.workers, c.progress, c.progressFormat, c.output, reportFileName, c.outputFileMode)
+report file mode: %v
+rate: %v
+timeout: %v
+retry: %v
+halt: %v
+result format: %v
+low memory: %v
+max output: %v
+output dir: %v
+tag: %v
+keep order: %v
+success: %v
+hunt: %v
+group outputs: %v
+normalize: %v
+template: %v
+seed: %v
+run id: %v
+env: %v
+shell: %v`, am, c.args, c.increment, c.workers, c.progress, c.progressFormat, c.output, reportFileName, c.outputFileMode, rateString(c.rate), c.timeout, c.retry, c.halt, c.resultFormat, c.lowMemory, c.outputLimit, templateString(c.outputDirTemplate), templateString(c.tagTemplate), c.keepOrder, c.success, c.hunt != nil, c.outputGroups != nil, c.normalizer, c.argTemplates != nil, c.seed, c.runID, envValuesString(c.env), c.shell)
 }
 
 func (c *configuredOper) writeOutput(res *Result) {
+	formatted := c.formatOutput(res)
+	if c.orderedOutput != nil {
+		// Attempts which will be retried are held back along with the rest of their task
+		final := !res.isFailure() || !c.retry.shouldRetry(res.Attempt)
+		c.orderedOutput.add(res.Idx, formatted, final)
+		return
+	}
+	c.emitOutput(formatted)
+}
+
+// formatOutput of the result as it's written, empty if it's hidden
+func (c *configuredOper) formatOutput(res *Result) string {
 	// If output on success is hidden and the outcome
 	// is not an error (a success), then return
-	if c.hideOutputOnSuccess && !res.IsError {
-		return
+	if c.hideOutputOnSuccess && !res.isFailure() {
+		return ""
 	}
 	formatted := res.Output
+	if res.Error != "" {
+		formatted = res.Error + "\n" + res.Output
+	}
 	if c.outputFormat == outputFormatV2 {
 		formatted = formatOutputV2(res)
+	} else if c.tagTemplate != nil && res.taggedOutput != "" {
+		formatted = res.taggedOutput
+	}
+	return formatted
+}
+
+// emitOutput to the output streams
+func (c *configuredOper) emitOutput(formatted string) {
+	if formatted == "" {
+		return
 	}
 	switch c.output {
 	case output.STDOUT:
@@ -196,6 +742,21 @@ func (c *configuredOper) writeOutput(res *Result) {
 	}
 }
 
+// writeResult to the result file as one line of json, if results are streamed
+func (c *configuredOper) writeResult(res *Result) {
+	if c.resultFile == nil || c.resultFormat != resultFormatJSONL {
+		return
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		printErr(fmt.Sprintf("failed to marshal result of task: %v, err: %v", res.Idx, err))
+		return
+	}
+	if _, err := c.resultFile.Write(append(b, '\n')); err != nil {
+		printErr(fmt.Sprintf("failed to write result of task: %v, err: %v", res.Idx, err))
+	}
+}
+
 func formatOutputV2(res *Result) string {
 	formatEvents := func(label string, events []OutputEvent) string {
 		out := fmt.Sprintf("%s:\n", label)
@@ -204,7 +765,17 @@ func formatOutputV2(res *Result) string {
 		}
 		return out
 	}
-	return fmt.Sprintf("%s---\n%s", formatEvents("stdout", res.Stdout), formatEvents("stderr", res.Stderr))
+	header := fmt.Sprintf("task: %v, attempt: %v, pid: %v, exit code: %v", res.Idx, res.Attempt, res.PID, res.ExitCode)
+	if res.Signal != "" {
+		header += fmt.Sprintf(", signal: %v", res.Signal)
+	}
+	header += fmt.Sprintf("\nstarted: %s, ended: %s\ncpu: user %v, system %v, max rss: %v\nargv: %q\n",
+		res.StartedAt.Format(time.RFC3339Nano), res.EndedAt.Format(time.RFC3339Nano),
+		res.UserTime, res.SystemTime, formatByteSize(res.MaxRSS), res.Argv)
+	if res.Error != "" {
+		header += fmt.Sprintf("error: %v\n", res.Error)
+	}
+	return fmt.Sprintf("%s%s---\n%s", header, formatEvents("stdout", res.Stdout), formatEvents("stderr", res.Stderr))
 }
 
 func (c *configuredOper) setupProgressStreams() []io.Writer {
@@ -221,11 +792,12 @@ func (c *configuredOper) setupProgressStreams() []io.Writer {
 	return progressStreams
 }
 
+// timeBounded returns true if the operation is repeated until a deadline,
+// instead of a fixed amount of times
+func (c *configuredOper) timeBounded() bool {
+	return c.duration > 0 || !c.deadline.IsZero()
+}
+
 func containsIncrementPlaceholder(args []string) bool {
-	for _, arg := range args {
-		if strings.Contains(arg, incrementPlaceholder) {
-			return true
-		}
-	}
-	return false
+	return containsPlaceholder(args, incrementPlaceholder)
 }
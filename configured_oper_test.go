@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
@@ -202,6 +204,52 @@ func Test_getTimeStrings(t *testing.T) {
 	})
 }
 
+func Test_configuredOper_run_duration(t *testing.T) {
+	t.Run("it should repeat until the duration has passed, then let in-flight tasks finish", func(t *testing.T) {
+		amWorkers := 2
+		c := configuredOper{
+			am:            1,
+			workers:       amWorkers,
+			amIdleWorkers: amWorkers,
+			duration:      300 * time.Millisecond,
+			args:          []string{"sleep", "0.1"},
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(amWorkers)
+
+		start := time.Now()
+		stats := c.run(context.Background())
+		elapsed := time.Since(start)
+
+		if elapsed < 300*time.Millisecond || elapsed > 2*time.Second {
+			t.Fatalf("expected run to last roughly the duration, got: %v", elapsed)
+		}
+		if stats.amDone <= 1 {
+			t.Fatalf("expected more tasks than -n to be done, got: %v", stats.amDone)
+		}
+		if stats.amCancelled != 0 {
+			t.Fatalf("expected in-flight tasks to finish, got %v cancelled", stats.amCancelled)
+		}
+	})
+
+	t.Run("time bounded estimates should be anchored to the deadline", func(t *testing.T) {
+		deadline := time.Now().Add(time.Hour)
+		c := configuredOper{
+			am:                    1,
+			deadline:              deadline,
+			rollingAverageRuntime: time.Second,
+		}
+		doneIn, doneAt := c.getTimeStrings(0)
+		if !doneAt.Equal(deadline) {
+			t.Fatalf("expected doneAt: %v, got: %v", deadline, doneAt)
+		}
+		if doneIn > time.Hour || doneIn < 59*time.Minute {
+			t.Fatalf("expected doneIn to be roughly an hour, got: %v", doneIn)
+		}
+	})
+}
+
 func Test_humanReadableDuration(t *testing.T) {
 	testCases := []struct {
 		name string
@@ -381,6 +429,9 @@ func Test_configuredOper_writeOutput_formatV2(t *testing.T) {
 	if !strings.Contains(got, "---\nstderr:\n1970-01-01T00:00:02Z: boom\n") {
 		t.Fatalf("expected stderr timeline in v2 output, got: %q", got)
 	}
+	if !strings.HasPrefix(got, "task: 0, attempt: 0, pid: 0, exit code: 0\n") {
+		t.Fatalf("expected process header in v2 output, got: %q", got)
+	}
 }
 
 func Test_outputRecorder_capturesTimestampedStreams(t *testing.T) {
@@ -493,10 +544,59 @@ func Test_configuredOper_run_cancellation(t *testing.T) {
 	})
 }
 
+func Test_configuredOper_run_timeout(t *testing.T) {
+	t.Run("it should kill hung commands, including children, and mark them as timeouts", func(t *testing.T) {
+		c := configuredOper{
+			am: 1,
+			// The trailing 'true' stops sh from exec:ing into sleep, so sleep is a child
+			args:          []string{"sh", "-c", "sleep 5; true"},
+			timeout:       100 * time.Millisecond,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+			amIdleWorkers: 1,
+		}
+		c.workerWg.Add(1)
+
+		started := time.Now()
+		stats := c.run(context.Background())
+		elapsed := time.Since(started)
+
+		if elapsed >= 3*time.Second {
+			t.Fatalf("expected timeout to stop the command promptly, got runtime %v", elapsed)
+		}
+		if len(stats.Results) != 1 {
+			t.Fatalf("expected 1 result, got: %v", len(stats.Results))
+		}
+		got := stats.Results[0]
+		if !got.IsTimeout || got.IsError || got.IsCancelled {
+			t.Fatalf("expected result to only be marked as timeout, got: %+v", got)
+		}
+		if stats.amTimeouts != 1 || stats.amFails != 0 {
+			t.Fatalf("expected 1 timeout and 0 failures, got: %v timeouts, %v failures", stats.amTimeouts, stats.amFails)
+		}
+	})
+
+	t.Run("it should not affect commands finishing in time", func(t *testing.T) {
+		c := configuredOper{
+			am:            1,
+			args:          []string{"true"},
+			timeout:       5 * time.Second,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+			amIdleWorkers: 1,
+		}
+		c.workerWg.Add(1)
+		stats := c.run(context.Background())
+		if stats.amTimeouts != 0 || stats.amFails != 0 {
+			t.Fatalf("expected no timeouts or failures, got: %v timeouts, %v failures", stats.amTimeouts, stats.amFails)
+		}
+	})
+}
+
 func Test_configuredOper_New(t *testing.T) {
 	t.Run("it should return incrementConfigError if increment is true and no args contains 'INC'", func(t *testing.T) {
 		args := []string{"test", "abc"}
-		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false)
+		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false, runOptions{})
 		if gotErr == nil {
 			t.Fatal("expected to get error, got nil")
 		}
@@ -515,7 +615,7 @@ func Test_configuredOper_New(t *testing.T) {
 
 	t.Run("it should not return an error if increment is true and one argument is 'INC'", func(t *testing.T) {
 		args := []string{"test", "abc", "INC"}
-		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false)
+		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false, runOptions{})
 		if gotErr != nil {
 			t.Fatalf("expected nil, got: %v", gotErr)
 		}
@@ -523,7 +623,7 @@ func Test_configuredOper_New(t *testing.T) {
 
 	t.Run("it should not return an error if increment is true and one argument contains 'INC'", func(t *testing.T) {
 		args := []string{"test", "abc", "another-argument/INC"}
-		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false)
+		_, gotErr := New(0, 0, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false, runOptions{})
 		if gotErr != nil {
 			t.Fatalf("expected nil, got: %v", gotErr)
 		}
@@ -533,7 +633,7 @@ func Test_configuredOper_New(t *testing.T) {
 		am := 1
 		workers := 2
 		args := []string{"test", "abc"}
-		_, gotErr := New(am, workers, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false)
+		_, gotErr := New(am, workers, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{})
 		if gotErr == nil {
 			t.Fatal("expected to get error, got nil")
 		}
@@ -547,25 +647,52 @@ func Test_configuredOper_New(t *testing.T) {
 
 	t.Run("it should not return an error if the number of workers is lower than the number of times to repeat the command", func(t *testing.T) {
 		args := []string{"test", "abc"}
-		_, gotErr := New(2, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false)
+		_, gotErr := New(2, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{})
 		if gotErr != nil {
 			t.Fatalf("expected nil, got: %v", gotErr)
 		}
 	})
 	t.Run("it should not return an error if the number of workers is equal to the number of times to repeat the command", func(t *testing.T) {
 		args := []string{"test", "abc"}
-		_, gotErr := New(2, 2, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false)
+		_, gotErr := New(2, 2, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{})
+		if gotErr != nil {
+			t.Fatalf("expected nil, got: %v", gotErr)
+		}
+	})
+
+	t.Run("it should allow more workers than repetitions when time bounded", func(t *testing.T) {
+		args := []string{"test", "abc"}
+		_, gotErr := New(1, 4, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{duration: time.Second})
 		if gotErr != nil {
 			t.Fatalf("expected nil, got: %v", gotErr)
 		}
 	})
 
+	t.Run("it should return error if both duration and until are set", func(t *testing.T) {
+		args := []string{"test", "abc"}
+		opts := runOptions{duration: time.Second, until: time.Now().Add(time.Hour).Format(time.RFC3339)}
+		_, gotErr := New(1, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, opts)
+		if gotErr == nil {
+			t.Fatal("expected to get error, got nil")
+		}
+	})
+
+	t.Run("it should return error if until has passed or is malformed", func(t *testing.T) {
+		args := []string{"test", "abc"}
+		for _, until := range []string{"2020-01-01T00:00:00Z", "tomorrow"} {
+			_, gotErr := New(1, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{until: until})
+			if gotErr == nil {
+				t.Fatalf("expected to get error for until: %q, got nil", until)
+			}
+		}
+	})
+
 	// Guards against the hideOutputOnSuccess argument being accepted but never
 	// wired into the returned struct (a dead flag).
 	t.Run("it should wire the hideOutputOnSuccess argument into the returned struct", func(t *testing.T) {
 		for _, want := range []bool{true, false} {
 			args := []string{"true"}
-			c, gotErr := New(1, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, want)
+			c, gotErr := New(1, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, want, runOptions{})
 			if gotErr != nil {
 				t.Fatalf("expected nil, got: %v", gotErr)
 			}
@@ -575,3 +702,120 @@ func Test_configuredOper_New(t *testing.T) {
 		}
 	})
 }
+
+func Test_configuredOper_run_resultFormatJSONL(t *testing.T) {
+	resultPath := t.TempDir() + "/results.jsonl"
+	runOnce := func(t *testing.T, fileMode string) {
+		t.Helper()
+		f, err := (&configuredOper{}).getFile(resultPath, fileMode)
+		if err != nil {
+			t.Fatalf("failed to get result file: %v", err)
+		}
+		defer f.Close()
+		c := configuredOper{
+			am:            3,
+			args:          []string{"printf", "INC"},
+			increment:     true,
+			resultFile:    f,
+			resultFormat:  resultFormatJSONL,
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+		c.run(context.Background())
+	}
+	runOnce(t, "")
+	// Appending should keep the file valid, one result per line
+	runOnce(t, "a")
+
+	b, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("failed to read result file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected: 6 lines, got: %v, content: %q", len(lines), b)
+	}
+	for _, line := range lines {
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("expected valid json on each line, got err: %v, line: %q", err, line)
+		}
+		if res.Output != fmt.Sprint(res.Idx) {
+			t.Fatalf("expected output: %q, got: %q", fmt.Sprint(res.Idx), res.Output)
+		}
+	}
+}
+
+func Test_configuredOper_New_resultFileMode(t *testing.T) {
+	resultPath := t.TempDir() + "/results.jsonl"
+	// The second run appends without querying, as the file then exists
+	for i := 0; i < 2; i++ {
+		c, err := New(3, 1, []string{"printf", "INC"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "a", true, resultPath, false, false, runOptions{resultFormat: resultFormatJSONL})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		c.run(context.Background())
+		c.resultFile.Close()
+	}
+
+	b, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("failed to read result file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("expected: 6 lines, got: %v, content: %q", len(lines), b)
+	}
+	for _, line := range lines {
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("expected valid json on each line, got err: %v, line: %q", err, line)
+		}
+	}
+}
+
+func Test_configuredOper_New_resultFormat(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{resultFormat: "xml"})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func Test_configuredOper_doWork_processFields(t *testing.T) {
+	c := configuredOper{args: []string{"sh", "-c", "echo out; exit 3"}}
+	before := time.Now().UTC()
+	res := c.doWork(context.Background(), 0, 0, 1, nil)
+	if res.ExitCode != 3 || res.Error != "exit status 3" || !res.IsError {
+		t.Fatalf("expected exit code 3 with its error, got: %+v", res)
+	}
+	if res.Output != "out\n" {
+		t.Fatalf("expected output to be left as is, got: %q", res.Output)
+	}
+	if res.PID == 0 {
+		t.Fatal("expected pid to be set")
+	}
+	if res.StartedAt.Before(before) || res.EndedAt.Sub(res.StartedAt) != res.Runtime {
+		t.Fatalf("expected timestamps spanning the runtime, got started: %v, ended: %v, runtime: %v", res.StartedAt, res.EndedAt, res.Runtime)
+	}
+	if !slices.Equal(res.Argv, c.args) {
+		t.Fatalf("expected argv: %v, got: %v", c.args, res.Argv)
+	}
+
+	t.Run("signal", func(t *testing.T) {
+		c := configuredOper{args: []string{"sh", "-c", "kill -TERM $$"}}
+		res := c.doWork(context.Background(), 0, 0, 1, nil)
+		if res.ExitCode != -1 || res.Signal != "terminated" {
+			t.Fatalf("expected exit code -1 and signal terminated, got: %v, %q", res.ExitCode, res.Signal)
+		}
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		c := configuredOper{args: []string{"/non/existent/command"}}
+		res := c.doWork(context.Background(), 0, 0, 1, nil)
+		if res.ExitCode != -1 || res.PID != 0 || res.Error == "" || res.Output != "" {
+			t.Fatalf("expected error without output, got: %+v", res)
+		}
+	})
+}
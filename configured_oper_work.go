@@ -9,13 +9,19 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/baalimago/go_away_boilerplate/pkg/ancli"
 	"github.com/baalimago/go_away_boilerplate/pkg/threadsafe"
+	"github.com/baalimago/repeater/internal/output"
 	"github.com/baalimago/repeater/pkg/filetools"
 )
 
+// maxResultBuffer is the maximum amount of results which may wait for the collector,
+// unless there are more workers than this
+const maxResultBuffer = 1024
+
 type outputStream string
 
 const (
@@ -26,9 +32,26 @@ const (
 type outputRecorder struct {
 	res    *Result
 	stream outputStream
+	// capture the output within a limit instead of writing it to res, if set
+	capture *outputCapture
+	// tagger of the output lines, if set
+	tagger *lineTagger
+	// mu guards res, as stdout and stderr are written concurrently, if set
+	mu *sync.Mutex
 }
 
 func (o outputRecorder) Write(p []byte) (n int, err error) {
+	if o.tagger != nil {
+		o.tagger.write(o.stream, p)
+	}
+	if o.capture != nil {
+		o.capture.write(o.stream, p)
+		return len(p), nil
+	}
+	if o.mu != nil {
+		o.mu.Lock()
+		defer o.mu.Unlock()
+	}
 	event := OutputEvent{At: time.Now().UTC(), Text: string(p)}
 	if o.stream == stdoutStream {
 		o.res.Stdout = append(o.res.Stdout, event)
@@ -53,15 +76,97 @@ func (c *configuredOper) replaceIncrement(args []string, i int) []string {
 	return args
 }
 
-func (c *configuredOper) doWork(ctx context.Context, workerID, taskIdx int, tee io.Writer) Result {
+// expandArgs of the task by executing the argument templates, then replacing the
+// increment, line and params placeholders
+func (c *configuredOper) expandArgs(taskIdx, workerID, attempt int) ([]string, error) {
+	args, err := c.executeArgTemplates(taskIdx, workerID, attempt)
+	if err != nil {
+		return nil, err
+	}
+	args = c.replaceIncrement(args, taskIdx)
+	args = c.replaceLine(args, taskIdx)
+	args = c.replaceParams(args, taskIdx)
+	return args, nil
+}
+
+func (c *configuredOper) doWork(ctx context.Context, workerID, taskIdx, attempt int, tee io.Writer) Result {
 	res := Result{
 		WorkerID: workerID,
 		Idx:      taskIdx,
+		Attempt:  attempt,
+		ExitCode: -1,
+	}
+	if c.lines != nil {
+		res.Input = c.lines[taskIdx]
+	}
+	if c.params != nil {
+		res.Params = c.params.values(taskIdx)
+	}
+	var tagger *lineTagger
+	if c.tagTemplate != nil {
+		tag, err := c.taskTag(taskIdx, workerID, attempt)
+		if err != nil {
+			res.Error = err.Error()
+			res.IsError = true
+			return res
+		}
+		tagger = newLineTagger(tag)
+	}
+	fail := func(err error) Result {
+		res.Error = err.Error()
+		res.IsError = true
+		if tagger != nil {
+			res.taggedOutput = tagger.finish(err)
+		}
+		return res
+	}
+	args, err := c.expandArgs(taskIdx, workerID, attempt)
+	if err != nil {
+		return fail(err)
+	}
+	res.Command = c.commandLine(args)
+	res.Argv = append([]string{c.args[0]}, args...)
+	env, err := c.taskEnv(taskIdx, workerID, attempt)
+	if err != nil {
+		return fail(err)
+	}
+	taskCtx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	do := exec.CommandContext(taskCtx, c.args[0], args...)
+	// Tasks may be cancelled by timeouts and halts, make sure that nothing started by
+	// the task outlives it
+	if c.cancelsInFlightTasks() {
+		killProcessGroupOnCancel(do)
+	}
+	do.Env = append(os.Environ(), env...)
+	var capture *outputCapture
+	if c.outputLimit.maxBytes > 0 {
+		capture = newOutputCapture(c.outputLimit, taskIdx, attempt)
+	}
+	// Captured output is tagged once it's cut, so that the tagged output is limited too
+	streamTagger := tagger
+	if capture != nil {
+		streamTagger = nil
+	}
+	resMu := &sync.Mutex{}
+	stdoutWriter := io.Writer(outputRecorder{res: &res, stream: stdoutStream, capture: capture, tagger: streamTagger, mu: resMu})
+	stderrWriter := io.Writer(outputRecorder{res: &res, stream: stderrStream, capture: capture, tagger: streamTagger, mu: resMu})
+	var outputFiles *taskOutputFiles
+	if c.outputDirTemplate != nil {
+		dir, err := c.taskOutputDir(taskIdx, workerID, attempt)
+		if err == nil {
+			outputFiles, err = openTaskOutputFiles(dir, attempt)
+		}
+		if err != nil {
+			return fail(err)
+		}
+		stdoutWriter = io.MultiWriter(stdoutWriter, outputFiles.stdout)
+		stderrWriter = io.MultiWriter(stderrWriter, outputFiles.stderr)
 	}
-	args := c.replaceIncrement(c.args[1:], taskIdx)
-	do := exec.CommandContext(ctx, c.args[0], args...)
-	stdoutWriter := io.Writer(outputRecorder{res: &res, stream: stdoutStream})
-	stderrWriter := io.Writer(outputRecorder{res: &res, stream: stderrStream})
 	if tee != nil {
 		do.Stdout = io.MultiWriter(stdoutWriter, tee)
 		do.Stderr = io.MultiWriter(stderrWriter, tee)
@@ -70,18 +175,48 @@ func (c *configuredOper) doWork(ctx context.Context, workerID, taskIdx int, tee
 		do.Stderr = stderrWriter
 	}
 	t0 := time.Now()
-	err := do.Run()
+	err = do.Run()
 	timeSpent := time.Since(t0)
+	res.StartedAt = t0.UTC()
+	res.EndedAt = res.StartedAt.Add(timeSpent)
+	if do.Process != nil {
+		res.PID = do.Process.Pid
+	}
+	if do.ProcessState != nil {
+		res.ExitCode = do.ProcessState.ExitCode()
+		res.Signal = exitSignal(do.ProcessState)
+		res.UserTime = do.ProcessState.UserTime()
+		res.SystemTime = do.ProcessState.SystemTime()
+		res.MaxRSS = maxRSS(do.ProcessState)
+	}
+	if capture != nil {
+		capture.finish(&res)
+		if tagger != nil {
+			tagger.write(stdoutStream, []byte(res.Output))
+		}
+	}
 	res.Runtime = timeSpent
 	res.RuntimeHumanReadable = timeSpent.String()
+	// Attempts which were cut short are never judged by the success criteria
+	if c.success != nil && ctx.Err() == nil && taskCtx.Err() == nil {
+		res.Rule, err = c.success.evaluate(&res, err)
+	}
 	if err != nil {
-		res.Output = err.Error() + res.Output
+		res.Error = err.Error()
 		if errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
 			res.IsCancelled = true
+		} else if errors.Is(taskCtx.Err(), context.DeadlineExceeded) {
+			res.IsTimeout = true
 		} else {
 			res.IsError = true
 		}
 	}
+	if tagger != nil {
+		res.taggedOutput = tagger.finish(err)
+	}
+	if outputFiles != nil {
+		outputFiles.finish(&res, c.outputDirMeta)
+	}
 	return res
 }
 
@@ -89,19 +224,23 @@ func (c *configuredOper) doWork(ctx context.Context, workerID, taskIdx int, tee
 func (c *configuredOper) setupWorkers(workCtx context.Context, workChan chan int, resultChan chan Result) {
 	for i := 0; i < c.workers; i++ {
 		go func(workerID int) {
-			tmpFile, err := os.CreateTemp("",
-				fmt.Sprintf("repeater-worker-%v-", workerID))
-			if err != nil {
-				ancli.Errf("failed to create temp output file: %v", err)
-			} else {
-				ancli.Noticef("output for worker: %v is in: %v", workerID, tmpFile.Name())
+			// Each task has its own files in the output dir, so the worker doesn't need one
+			var tee io.Writer
+			if c.outputDirTemplate == nil {
+				tmpFile, err := os.CreateTemp("",
+					fmt.Sprintf("repeater-worker-%v-", workerID))
+				if err != nil {
+					ancli.Errf("failed to create temp output file: %v", err)
+				} else {
+					ancli.Noticef("output for worker: %v is in: %v", workerID, tmpFile.Name())
+					tee = tmpFile
+				}
 			}
 			for {
 				select {
 				case <-workCtx.Done():
-					c.workPlanMu.Lock()
-					c.wasCancelled = true
-					c.workPlanMu.Unlock()
+					// Idle workers are released this way on normal completion too, so cancellation
+					// is only recorded by workers with in-flight tasks
 					c.workerWg.Done()
 					return
 				case taskIdx := <-workChan:
@@ -110,45 +249,103 @@ func (c *configuredOper) setupWorkers(workCtx context.Context, workChan chan int
 					requestedTasks := c.am
 					// The current amount of workers is enough to reach the requested
 					// amount of tasks in parallel so kill off this worker to not overshoot
-					// the amount of repetitions
-					if workingWorkrs+c.amSuccess >= requestedTasks || (!c.retryOnFail && taskIdx >= requestedTasks) {
+					// the amount of repetitions. When time bounded, only the deadline matters
+					enoughWorkers := workingWorkrs+c.amSuccess >= requestedTasks || taskIdx >= requestedTasks
+					if c.timeBounded() {
+						enoughWorkers = !time.Now().Before(c.deadline)
+					}
+					if enoughWorkers || c.haltReason != "" {
+						if c.orderedOutput != nil {
+							c.orderedOutput.skip(taskIdx)
+						}
 						c.workerWg.Done()
 						c.workPlanMu.Unlock()
 						return
 					}
 					c.amIdleWorkers--
 					c.workPlanMu.Unlock()
-					res := c.doWork(workCtx, workerID, taskIdx, tmpFile)
-					if workCtx.Err() != nil {
-						c.workPlanMu.Lock()
-						c.wasCancelled = true
-						c.workPlanMu.Unlock()
-					}
-					c.workPlanMu.Lock()
-					c.amIdleWorkers++
-					if !res.IsError {
-						c.amSuccess++
-					}
-					c.workPlanMu.Unlock()
-					resultChan <- res
+					c.runTask(workCtx, workerID, taskIdx, tee, resultChan)
 				}
 			}
 		}(i)
 	}
 }
 
+// runTask until it succeeds or the retry policy gives up, retrying on the same task index.
+// Every attempt is sent to the resultChan. The worker is marked as idle before the
+// final attempt is sent.
+func (c *configuredOper) runTask(workCtx context.Context, workerID, taskIdx int, tee io.Writer, resultChan chan Result) {
+	for attempt := 1; ; attempt++ {
+		c.workPlanMu.Lock()
+		c.amDispatched++
+		c.workPlanMu.Unlock()
+		res := c.doWork(workCtx, workerID, taskIdx, attempt, tee)
+		willRetry := res.isFailure() && c.retry.shouldRetry(attempt) &&
+			threadsafe.Read(c.workPlanMu, &c.haltReason) == ""
+		if willRetry {
+			// Send before backing off, so that the attempt is visible in the progress
+			resultChan <- res
+			err := c.retry.wait(workCtx, attempt)
+			if err == nil && c.limiter != nil {
+				err = c.limiter.wait(workCtx)
+			}
+			if err == nil {
+				continue
+			}
+		}
+		c.workPlanMu.Lock()
+		if workCtx.Err() != nil {
+			c.wasCancelled = true
+		}
+		c.amIdleWorkers++
+		if !res.isFailure() {
+			c.amSuccess++
+		}
+		c.workPlanMu.Unlock()
+		if !willRetry {
+			resultChan <- res
+		}
+		return
+	}
+}
+
+// waitForRate until the rate limiter allows another task. When time bounded,
+// the wait is cut short at the deadline, so that workers may be released without delay.
+func (c *configuredOper) waitForRate(ctx context.Context) error {
+	if !c.timeBounded() {
+		return c.limiter.wait(ctx)
+	}
+	deadlineCtx, cancel := context.WithDeadline(ctx, c.deadline)
+	defer cancel()
+	err := c.limiter.wait(deadlineCtx)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
 func (c *configuredOper) runDelegator(ctx context.Context, workChan chan int) error {
 	i := 0
 	for {
 		if ctx.Err() != nil {
 			return nil
 		}
+		if c.limiter != nil {
+			if err := c.waitForRate(ctx); err != nil {
+				return nil
+			}
+		}
 		select {
 		case <-ctx.Done():
 			return nil
 		case workChan <- i:
+			// When time bounded, keep handing out tasks so that the workers may
+			// observe the deadline and quit once their in-flight task is done
 			amSuccess := threadsafe.Read(c.workPlanMu, &c.amSuccess)
-			if amSuccess >= c.am {
+			if amSuccess >= c.am && !c.timeBounded() {
 				return nil
 			} else {
 				i++
@@ -186,7 +383,10 @@ func humanReadableDuration(d time.Duration) string {
 }
 
 func (c *configuredOper) getTimeStrings(amSuccess int) (doneIn time.Duration, doneAt time.Time) {
-	amResults := len(c.results)
+	if c.timeBounded() {
+		return max(time.Until(c.deadline), 0), c.deadline
+	}
+	amResults := c.amResults()
 	tasksLeft := c.am - amResults
 	// If we retry on fail, calculate the failure rate and multiply the remaining tasks with
 	// failure rate to estimate how many attempts it will take to complete all
@@ -196,34 +396,111 @@ func (c *configuredOper) getTimeStrings(amSuccess int) (doneIn time.Duration, do
 		tasksLeft = int((float32(tasksLeft) / successRate))
 	}
 	doneIn = c.rollingAverageRuntime * time.Duration(tasksLeft)
+	// When rate limited, the tasks can't be started faster than the rate allows
+	if c.rate > 0 {
+		doneIn = max(doneIn, time.Duration(float64(tasksLeft)/c.rate*float64(time.Second)))
+	}
 	// fmt.Printf("avg runtime time: %v, est tasks left: %v", c.rollingAverageRuntime, tasksLeft)
 	doneAt = time.Now().Add(doneIn)
 	return
 }
 
+// aggregate the result into the statistics, and keep it unless running with low memory
+func (c *configuredOper) aggregate(res Result) {
+	c.agg.add(res)
+	if c.combinationAggs != nil {
+		c.combinationAggs[c.params.rowIdx(res.Idx)].add(res)
+	}
+	if !c.lowMemory {
+		res.taggedOutput = ""
+		c.results = append(c.results, res)
+	}
+}
+
+// amResults which have been collected
+func (c *configuredOper) amResults() int {
+	if c.agg != nil {
+		return c.agg.amDone
+	}
+	return len(c.results)
+}
+
+// checkHalt by counting the finished tasks and halting the run if the halt policy is
+// breached. Attempts which will be retried aren't counted as finished.
+func (c *configuredOper) checkHalt(res Result) {
+	if !c.halt.enabled() || res.IsCancelled || (res.isFailure() && c.retry.shouldRetry(res.Attempt)) {
+		return
+	}
+	c.amHaltFinished++
+	if res.isFailure() {
+		c.amHaltFails++
+	}
+	reason, breached := c.halt.breached(c.amHaltFails, c.amHaltFinished)
+	if !breached {
+		return
+	}
+	c.haltRun(reason, c.halt.when == haltNow)
+}
+
+// cancelsInFlightTasks is true if tasks may be cancelled while the run goes on, by a
+// timeout, halting now or a hunt. Only then are tasks started in their own process group,
+// as it leaves the foreground process group of the terminal, so that Ctrl+C and job
+// control no longer reach the command directly.
+func (c *configuredOper) cancelsInFlightTasks() bool {
+	return c.timeout > 0 || (c.halt.enabled() && c.halt.when == haltNow) || c.hunt != nil
+}
+
+// haltRun by no longer dispatching new tasks, unless it's already halted. In-flight tasks
+// are cancelled if cancelInFlight is set.
+func (c *configuredOper) haltRun(reason string, cancelInFlight bool) {
+	c.workPlanMu.Lock()
+	alreadyHalted := c.haltReason != ""
+	if !alreadyHalted {
+		c.haltReason = reason
+	}
+	c.workPlanMu.Unlock()
+	if !alreadyHalted && cancelInFlight && c.cancelWork != nil {
+		c.cancelWork()
+	}
+}
+
+// rateProgress describes the achieved dispatch rate versus the targeted one
+func (c *configuredOper) rateProgress() string {
+	amDispatched := threadsafe.Read(c.workPlanMu, &c.amDispatched)
+	achieved := 0.0
+	if elapsed := time.Since(c.startedAt).Seconds(); elapsed > 0 {
+		achieved = float64(amDispatched) / elapsed
+	}
+	return fmt.Sprintf(", Rate (achieved/target): %.2f/%.2f per second", achieved, c.rate)
+}
+
 func (c *configuredOper) runResultCollector(ctx context.Context, resultChan chan Result, progressStreams []io.Writer) {
-	c.startedAt = time.Now()
 	handleRes := func(res Result) int {
 		c.writeOutput(&res)
-		c.results = append(c.results, res)
-		amFails := 0
-		for _, r := range c.results {
-			if r.IsError {
-				amFails++
-			}
-		}
-		tot := len(c.results)
+		c.outputGroups.add(&res)
+		c.writeResult(&res)
+		c.aggregate(res)
+		amFails := c.agg.amFailedAttempts()
+		tot := c.agg.amDone
 		c.totalRuntime += res.Runtime
 		runtimeAsFloat := float64(c.totalRuntime)
 		c.rollingAverageRuntime = time.Duration(runtimeAsFloat / float64(tot))
 		amSuccess := tot - amFails
+		c.checkHalt(res)
+		c.checkHunt(res)
 		timeLeft, estCompletion := c.getTimeStrings(amSuccess)
-		filetools.WriteStringIfPossible(
-			fmt.Sprintf(c.progressFormat,
-				amSuccess, amFails, c.am,
-				c.startedAt.Format(time.RFC3339), humanReadableDuration(timeLeft), estCompletion.Format(time.RFC3339)),
-			progressStreams,
-		)
+		// When time bounded there is no requested amount, so show elapsed time instead
+		requested := any(c.am)
+		if c.timeBounded() {
+			requested = humanReadableDuration(time.Since(c.startedAt))
+		}
+		progress := fmt.Sprintf(c.progressFormat,
+			amSuccess, amFails, requested,
+			c.startedAt.Format(time.RFC3339), humanReadableDuration(timeLeft), estCompletion.Format(time.RFC3339))
+		if c.rate > 0 {
+			progress += c.rateProgress()
+		}
+		filetools.WriteStringIfPossible(progress, progressStreams)
 		return amSuccess
 	}
 
@@ -245,8 +522,9 @@ func (c *configuredOper) runResultCollector(ctx context.Context, resultChan chan
 		case res := <-resultChan:
 			amSuccess := handleRes(res)
 			c.workPlanMu.Lock()
-			// Escape condition so that all results are collected
-			if amSuccess >= c.am && c.amIdleWorkers == c.workers {
+			// Escape condition so that all results are collected. When time bounded,
+			// the run ends as the workers quit, which cancels ctx
+			if amSuccess >= c.am && c.amIdleWorkers == c.workers && !c.timeBounded() {
 				c.workPlanMu.Unlock()
 				return
 			}
@@ -261,12 +539,28 @@ func (c *configuredOper) run(rootCtx context.Context) statistics {
 	ctx, ctxCancel := context.WithCancel(rootCtx)
 	progressStreams := c.setupProgressStreams()
 	workChan := make(chan int)
-	// Buffer the channel for each worker, so that the workers may leave a result and then quit
-	resultChan := make(chan Result, c.am)
-	workCtx, workCtxCancel := context.WithCancel(ctx)
 	if c.workers < 1 {
 		c.workers = 1
 	}
+	c.startedAt = time.Now()
+	c.agg = newAggregator(c.retry, c.histogram)
+	if c.params != nil && c.params.isMatrix() {
+		c.combinationAggs = make([]*aggregator, len(c.params.rows))
+		for i := range c.combinationAggs {
+			c.combinationAggs[i] = newAggregator(c.retry, c.histogram)
+		}
+	}
+	if c.duration > 0 {
+		c.deadline = c.startedAt.Add(c.duration)
+	}
+	if c.keepOrder && c.output != output.HIDDEN {
+		c.orderedOutput = newOrderedOutput(c.keepOrderBuffer, c.emitOutput)
+	}
+	// Buffer the channel for each worker, so that the workers may leave a result and then quit.
+	// The buffer is capped so that its memory doesn't grow with the amount of tasks.
+	resultChan := make(chan Result, max(min(c.am, maxResultBuffer), c.workers))
+	workCtx, workCtxCancel := context.WithCancel(ctx)
+	c.cancelWork = workCtxCancel
 	c.setupWorkers(workCtx, workChan, resultChan)
 
 	go func() {
@@ -284,6 +578,9 @@ func (c *configuredOper) run(rootCtx context.Context) statistics {
 		}
 	}()
 	c.runResultCollector(ctx, resultChan, progressStreams)
+	if c.orderedOutput != nil {
+		c.orderedOutput.flush()
+	}
 	c.runtime = time.Since(confOperStart)
 
 	return c.calcStats()
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dryRun prints the task plan to w, without running any commands. Each task is printed
+// with its expanded command line and the environment which is added to the command.
+// Workers pick tasks as they become idle, so the worker of each task is nominal.
+// Returns the amount of tasks which failed to expand.
+func (c *configuredOper) dryRun(w io.Writer) int {
+	am := c.am
+	if c.timeBounded() {
+		// The amount of tasks depends on their runtime, so show what every worker starts with
+		am = c.workers
+		fmt.Fprintf(w, "amount of tasks depends on their runtime, showing the first: %v\n", am)
+	}
+	amFailed := 0
+	for taskIdx := 0; taskIdx < am; taskIdx++ {
+		workerID := taskIdx % c.workers
+		fmt.Fprintf(w, "task: %v, worker: %v\n", taskIdx, workerID)
+		args, err := c.expandArgs(taskIdx, workerID, 1)
+		if err != nil {
+			amFailed++
+			fmt.Fprintf(w, "  error: %v\n", err)
+			continue
+		}
+		env, err := c.taskEnv(taskIdx, workerID, 1)
+		if err != nil {
+			amFailed++
+			fmt.Fprintf(w, "  error: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "  command: %v\n  env: %v\n", c.commandLine(args), strings.Join(env, " "))
+		if c.outputDirTemplate != nil {
+			dir, err := c.taskOutputDir(taskIdx, workerID, 1)
+			if err != nil {
+				amFailed++
+				fmt.Fprintf(w, "  error: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(w, "  output dir: %v\n", dir)
+		}
+	}
+	fmt.Fprintf(w, "dry run of %v tasks on %v workers, no commands were run\n", am, c.workers)
+	return amFailed
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_configuredOper_dryRun(t *testing.T) {
+	t.Run("it should print every expanded task without running it", func(t *testing.T) {
+		marker := t.TempDir() + "/ran"
+		c, err := New(3, 2, []string{"touch", marker + "-INC"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false, runOptions{env: []string{"SHARD=INC"}, dryRun: true})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		var sb strings.Builder
+		if amFailed := c.dryRun(&sb); amFailed != 0 {
+			t.Fatalf("expected: 0 failed tasks, got: %v", amFailed)
+		}
+		got := sb.String()
+		for _, want := range []string{
+			"task: 0, worker: 0\n",
+			"task: 1, worker: 1\n",
+			"task: 2, worker: 0\n",
+			"command: touch " + marker + "-2\n",
+			"REPEATER_TOTAL=3 SHARD=1\n",
+		} {
+			if !strings.Contains(got, want) {
+				t.Fatalf("expected output to contain: %q, got: %q", want, got)
+			}
+		}
+		if _, err := os.Stat(marker + "-0"); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected command not to run, got stat err: %v", err)
+		}
+	})
+
+	t.Run("it should not create the report files", func(t *testing.T) {
+		resultFile := t.TempDir() + "/result.json"
+		_, err := New(1, 1, []string{"echo"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, resultFile, false, false, runOptions{dryRun: true})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if _, err := os.Stat(resultFile); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected no result file, got stat err: %v", err)
+		}
+	})
+
+	t.Run("it should report tasks which fail to expand", func(t *testing.T) {
+		c := configuredOper{am: 2, workers: 1, args: []string{"echo", "{}"}, lines: []string{"a", "b"}}
+		c.argTemplates, _ = parseArgTemplates([]string{"{{mod 1 .Idx}}"}, nil, false)
+		var sb strings.Builder
+		if amFailed := c.dryRun(&sb); amFailed != 1 {
+			t.Fatalf("expected: 1 failed task, got: %v, output: %q", amFailed, sb.String())
+		}
+	})
+}
+
+func Test_configuredOper_New_reportsEveryProblem(t *testing.T) {
+	_, err := New(1, 2, []string{"echo"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", true, "", false, false, runOptions{halt: "bogus", rate: "x", timeout: -1})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	var ice incrementConfigError
+	if !errors.As(err, &ice) {
+		t.Fatalf("expected to get incrementConfigError, got: %v", err)
+	}
+	for _, want := range []string{"workers", "halt", "rate", "timeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected error to mention: %q, got: %v", want, err)
+		}
+	}
+
+	t.Run("it should report template execution errors along with the others", func(t *testing.T) {
+		_, err := New(1, 1, []string{"echo", "{{.Bogus}}"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{template: true, timeout: -1})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+		for _, want := range []string{"Bogus", "timeout"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Fatalf("expected error to mention: %q, got: %v", want, err)
+			}
+		}
+	})
+}
+
+func Test_dryRunFlag(t *testing.T) {
+	defer func() { *dryRunFlag = false }()
+	for _, name := range []string{"dry-run", "dryRun"} {
+		*dryRunFlag = false
+		if err := flag.Set(name, "true"); err != nil {
+			t.Fatalf("expected flag: %v, to be registered, got: %v", name, err)
+		}
+		if !*dryRunFlag {
+			t.Fatalf("expected flag: %v, to set dry run", name)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Environment variables which expose the metadata of the task to the command
+const (
+	envTaskIdx  = "REPEATER_TASK_IDX"
+	envWorkerID = "REPEATER_WORKER_ID"
+	envAttempt  = "REPEATER_ATTEMPT"
+	envRunID    = "REPEATER_RUN_ID"
+	// envTotal is the requested amount of tasks, unset when time bounded
+	envTotal = "REPEATER_TOTAL"
+	envSeed  = "REPEATER_SEED"
+)
+
+// envVar is a user supplied environment variable. The value may contain the same
+// placeholders as the arguments.
+type envVar struct {
+	key   string
+	value string
+}
+
+// parseEnv entries on the format 'KEY=VALUE'
+func parseEnv(entries []string) ([]envVar, error) {
+	ret := make([]envVar, 0, len(entries))
+	for _, entry := range entries {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("env: %q, is missing '=', expected format 'KEY=VALUE'", entry)
+		}
+		if key == "" || strings.ContainsAny(key, " \t\n") {
+			return nil, fmt.Errorf("env: %q, has an invalid key: %q", entry, key)
+		}
+		ret = append(ret, envVar{key: key, value: value})
+	}
+	return ret, nil
+}
+
+func envValues(env []envVar) []string {
+	ret := make([]string, 0, len(env))
+	for _, e := range env {
+		ret = append(ret, e.value)
+	}
+	return ret
+}
+
+func envValuesString(env []envVar) string {
+	entries := make([]string, 0, len(env))
+	for _, e := range env {
+		entries = append(entries, e.key+"="+e.value)
+	}
+	return strings.Join(entries, " ")
+}
+
+// parseEnvTemplates of the values of the user supplied environment variables
+func parseEnvTemplates(env []envVar, params *paramTable) ([]*template.Template, error) {
+	tmpls, err := parseArgTemplates(envValues(env), params, false)
+	if err != nil {
+		return nil, fmt.Errorf("env: %w", err)
+	}
+	return tmpls, nil
+}
+
+// newRunID which identifies the run. It's random regardless of the seed, so that
+// reproduced runs may be told apart.
+func newRunID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return formatUUIDv4(b)
+}
+
+// taskEnv returns the environment variables of the task on the format 'KEY=VALUE', with
+// the metadata of the task first so that the user may override it
+func (c *configuredOper) taskEnv(taskIdx, workerID, attempt int) ([]string, error) {
+	ret := []string{
+		envTaskIdx + "=" + strconv.Itoa(taskIdx),
+		envWorkerID + "=" + strconv.Itoa(workerID),
+		envAttempt + "=" + strconv.Itoa(attempt),
+		envRunID + "=" + c.runID,
+		envSeed + "=" + strconv.FormatInt(c.seed, 10),
+	}
+	if !c.timeBounded() {
+		ret = append(ret, envTotal+"="+strconv.Itoa(c.am))
+	}
+	if len(c.env) == 0 {
+		return ret, nil
+	}
+	values := envValues(c.env)
+	if c.envTemplates != nil {
+		var err error
+		values, err = executeTemplates(c.envTemplates, c.templateData(taskIdx, workerID, attempt))
+		if err != nil {
+			return nil, fmt.Errorf("failed to execute env template: %w", err)
+		}
+	}
+	values = c.replaceIncrement(values, taskIdx)
+	values = c.replaceLinePlaceholder(values, taskIdx, nil)
+	if c.params != nil {
+		values = c.params.replace(values, taskIdx, nil)
+	}
+	for i, e := range c.env {
+		ret = append(ret, e.key+"="+values[i])
+	}
+	return ret, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func Test_parseEnv(t *testing.T) {
+	got, err := parseEnv([]string{"A=1", "B=", "C=x=y"})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	want := []envVar{{"A", "1"}, {"B", ""}, {"C", "x=y"}}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+	for _, given := range []string{"A", "=1", "A B=1"} {
+		if _, err := parseEnv([]string{given}); err == nil {
+			t.Fatalf("for: %q, expected error, got nil", given)
+		}
+	}
+}
+
+func Test_configuredOper_taskEnv(t *testing.T) {
+	t.Run("it should expose task metadata", func(t *testing.T) {
+		c := configuredOper{am: 10, runID: "run", seed: 5}
+		got, err := c.taskEnv(3, 1, 2)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		want := []string{
+			"REPEATER_TASK_IDX=3",
+			"REPEATER_WORKER_ID=1",
+			"REPEATER_ATTEMPT=2",
+			"REPEATER_RUN_ID=run",
+			"REPEATER_SEED=5",
+			"REPEATER_TOTAL=10",
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("it should replace placeholders in user supplied values", func(t *testing.T) {
+		c := configuredOper{
+			am:        10,
+			increment: true,
+			lines:     []string{"a", "b"},
+			params:    &paramTable{columns: []string{"user"}, rows: [][]string{{"x"}, {"y"}}},
+			env:       []envVar{{"INDEX", "INC"}, {"LINE", "{}"}, {"USER", "{{user}}"}},
+		}
+		got, err := c.taskEnv(1, 0, 1)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		want := []string{"INDEX=1", "LINE=b", "USER=y"}
+		if !slices.Equal(got[len(got)-3:], want) {
+			t.Fatalf("expected to end with: %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("it should execute templates in user supplied values", func(t *testing.T) {
+		env := []envVar{{"PADDED", "{{pad 3 .Idx}}"}}
+		tmpls, err := parseEnvTemplates(env, nil)
+		if err != nil {
+			t.Fatalf("failed to parse templates: %v", err)
+		}
+		c := configuredOper{am: 10, env: env, envTemplates: tmpls}
+		got, err := c.taskEnv(7, 0, 1)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if want := "PADDED=007"; got[len(got)-1] != want {
+			t.Fatalf("expected: %q, got: %q", want, got[len(got)-1])
+		}
+	})
+}
+
+func Test_configuredOper_run_env(t *testing.T) {
+	c := configuredOper{
+		am:            3,
+		args:          []string{"sh", "-c", `printf "%s/%s:%s" "$REPEATER_TASK_IDX" "$REPEATER_TOTAL" "$NAME"`},
+		env:           []envVar{{"NAME", "task-INC"}},
+		increment:     true,
+		runID:         newRunID(),
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	for _, r := range stats.Results {
+		want := strings.ReplaceAll("INC/3:task-INC", "INC", strconv.Itoa(r.Idx))
+		if r.Output != want {
+			t.Fatalf("expected: %q, got: %q", want, r.Output)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+// Exit codes of repeater. These are part of the public interface, so don't
+// change existing values.
+const (
+	// exitOK means that all tasks succeeded
+	exitOK = 0
+	// exitTaskFailure means that at least one task failed
+	exitTaskFailure = 1
+	// exitConfigError means that the run never started due to bad configuration
+	exitConfigError = 2
+	// exitHalted means that the run was stopped by the halt policy
+	exitHalted = 3
+	// exitCancelled means that the run was cancelled by a termination signal,
+	// same as shells report for SIGINT
+	exitCancelled = 130
+)
+
+// exitCode for the outcome of the run. Cancellation and halting take precedence
+// over failed tasks, as the run didn't complete.
+func (s *statistics) exitCode() int {
+	switch {
+	case s.cancelled:
+		return exitCancelled
+	case s.hunt != nil && s.hunt.Found:
+		// The hunt halts the run once it finds what it's looking for
+		return exitTaskFailure
+	case s.haltReason != "":
+		return exitHalted
+	case s.amFailedTasks > 0:
+		return exitTaskFailure
+	}
+	return exitOK
+}
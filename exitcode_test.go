@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func Test_statistics_exitCode(t *testing.T) {
+	testCases := []struct {
+		name  string
+		given statistics
+		want  int
+	}{
+		{
+			name:  "all tasks succeeded",
+			given: statistics{am: 3, amDone: 3},
+			want:  exitOK,
+		},
+		{
+			name:  "failed attempts which were retried successfully aren't failures",
+			given: statistics{am: 3, amDone: 5, amFails: 2},
+			want:  exitOK,
+		},
+		{
+			name:  "some tasks failed",
+			given: statistics{am: 3, amDone: 3, amFails: 1, amFailedTasks: 1},
+			want:  exitTaskFailure,
+		},
+		{
+			name:  "halted takes precedence over failed tasks",
+			given: statistics{am: 3, amDone: 1, amFails: 1, amFailedTasks: 1, haltReason: "1 failed tasks reached threshold of 1"},
+			want:  exitHalted,
+		},
+		{
+			name:  "cancelled takes precedence over everything",
+			given: statistics{am: 3, amDone: 1, amFailedTasks: 1, haltReason: "1 failed tasks reached threshold of 1", cancelled: true},
+			want:  exitCancelled,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.given.exitCode(); got != tc.want {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_calcStats_exitCode(t *testing.T) {
+	t.Run("it should not count retried attempts as failed tasks", func(t *testing.T) {
+		c := configuredOper{
+			am:    1,
+			retry: retryPolicy{maxAttempts: 3},
+			results: []Result{
+				{Idx: 0, Attempt: 1, IsError: true},
+				{Idx: 0, Attempt: 2},
+			},
+		}
+		stats := c.calcStats()
+		if got := stats.exitCode(); got != exitOK {
+			t.Fatalf("expected: %v, got: %v", exitOK, got)
+		}
+	})
+
+	t.Run("it should count timeouts as failed tasks", func(t *testing.T) {
+		c := configuredOper{
+			am:      1,
+			results: []Result{{Idx: 0, Attempt: 1, IsTimeout: true}},
+		}
+		stats := c.calcStats()
+		if got := stats.exitCode(); got != exitTaskFailure {
+			t.Fatalf("expected: %v, got: %v", exitTaskFailure, got)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type haltWhen string
+
+const (
+	// haltSoon stops dispatching new tasks, but lets in-flight tasks finish
+	haltSoon haltWhen = "soon"
+	// haltNow stops dispatching new tasks and cancels in-flight tasks
+	haltNow haltWhen = "now"
+)
+
+// haltMinTasksForPercent is the amount of finished tasks required before a
+// percentage threshold may be breached, same as GNU parallel
+const haltMinTasksForPercent = 3
+
+// haltPolicy decides when to stop the run due to failing tasks. The zero value
+// never halts.
+type haltPolicy struct {
+	when haltWhen
+	// fails is the amount of failed tasks which halts the run, 0 if unset
+	fails int
+	// failPercent is the percentage, (0, 100], of failed tasks which halts the run, 0 if unset
+	failPercent float64
+}
+
+// parseHalt parses a halt policy on the format '<when>,fail=<threshold>', where
+// when is one of ['soon', 'now'] and threshold is an amount, such as '3', or a
+// percentage, such as '10%'. 'never', or an empty string, disables halting.
+func parseHalt(s string) (haltPolicy, error) {
+	if s == "" || s == "never" {
+		return haltPolicy{}, nil
+	}
+	whenStr, threshold, hasThreshold := strings.Cut(s, ",")
+	when := haltWhen(whenStr)
+	if when != haltSoon && when != haltNow {
+		return haltPolicy{}, fmt.Errorf("unrecognized halt: %q, expected to start with one of ['%v', '%v']", s, haltSoon, haltNow)
+	}
+	if !hasThreshold {
+		return haltPolicy{}, fmt.Errorf("halt: %q, is missing threshold, such as '%v,fail=1'", s, when)
+	}
+	amStr, isFail := strings.CutPrefix(threshold, "fail=")
+	if !isFail {
+		return haltPolicy{}, fmt.Errorf("unrecognized halt threshold: %q, expected format 'fail=<amount>' or 'fail=<percentage>%%'", threshold)
+	}
+	if percentStr, isPercent := strings.CutSuffix(amStr, "%"); isPercent {
+		percent, err := strconv.ParseFloat(percentStr, 64)
+		if err != nil {
+			return haltPolicy{}, fmt.Errorf("failed to parse halt percentage: %q, err: %w", amStr, err)
+		}
+		if percent <= 0 || percent > 100 {
+			return haltPolicy{}, fmt.Errorf("halt percentage must be within (0, 100], got: %q", amStr)
+		}
+		return haltPolicy{when: when, failPercent: percent}, nil
+	}
+	am, err := strconv.Atoi(amStr)
+	if err != nil {
+		return haltPolicy{}, fmt.Errorf("failed to parse halt amount: %q, err: %w", amStr, err)
+	}
+	if am < 1 {
+		return haltPolicy{}, fmt.Errorf("halt amount must be at least 1, got: %q", amStr)
+	}
+	return haltPolicy{when: when, fails: am}, nil
+}
+
+func (hp haltPolicy) enabled() bool {
+	return hp.fails > 0 || hp.failPercent > 0
+}
+
+// breached returns the reason for halting, and true, if the amount of failed tasks out of
+// the amount of finished tasks breaches the policy
+func (hp haltPolicy) breached(amFails, amFinished int) (string, bool) {
+	if hp.fails > 0 && amFails >= hp.fails {
+		return fmt.Sprintf("%v failed tasks reached threshold of %v", amFails, hp.fails), true
+	}
+	if hp.failPercent > 0 && amFinished >= haltMinTasksForPercent {
+		percent := 100 * float64(amFails) / float64(amFinished)
+		if percent >= hp.failPercent {
+			return fmt.Sprintf("%v of %v tasks failed (%.1f%%), reaching threshold of %v%%", amFails, amFinished, percent, hp.failPercent), true
+		}
+	}
+	return "", false
+}
+
+func (hp haltPolicy) String() string {
+	switch {
+	case hp.fails > 0:
+		return fmt.Sprintf("%v,fail=%v", hp.when, hp.fails)
+	case hp.failPercent > 0:
+		return fmt.Sprintf("%v,fail=%v%%", hp.when, hp.failPercent)
+	}
+	return "never"
+}
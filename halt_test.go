@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_parseHalt(t *testing.T) {
+	testCases := []struct {
+		given   string
+		want    haltPolicy
+		wantErr bool
+	}{
+		{given: "", want: haltPolicy{}},
+		{given: "never", want: haltPolicy{}},
+		{given: "now,fail=1", want: haltPolicy{when: haltNow, fails: 1}},
+		{given: "soon,fail=3", want: haltPolicy{when: haltSoon, fails: 3}},
+		{given: "soon,fail=10%", want: haltPolicy{when: haltSoon, failPercent: 10}},
+		{given: "later,fail=1", wantErr: true},
+		{given: "now", wantErr: true},
+		{given: "now,success=1", wantErr: true},
+		{given: "now,fail=0", wantErr: true},
+		{given: "now,fail=101%", wantErr: true},
+		{given: "now,fail=many", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			got, err := parseHalt(tc.given)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got: %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected: %+v, got: %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_haltPolicy_breached(t *testing.T) {
+	t.Run("it should breach on amount of failures", func(t *testing.T) {
+		hp := haltPolicy{when: haltNow, fails: 2}
+		if _, breached := hp.breached(1, 10); breached {
+			t.Fatal("expected 1 failure to not breach threshold of 2")
+		}
+		if _, breached := hp.breached(2, 10); !breached {
+			t.Fatal("expected 2 failures to breach threshold of 2")
+		}
+	})
+
+	t.Run("it should breach on percentage of failures, after enough tasks", func(t *testing.T) {
+		hp := haltPolicy{when: haltSoon, failPercent: 50}
+		if _, breached := hp.breached(2, 2); breached {
+			t.Fatal("expected percentage to not be checked before enough tasks have finished")
+		}
+		if _, breached := hp.breached(1, 4); breached {
+			t.Fatal("expected 25% to not breach threshold of 50%")
+		}
+		if _, breached := hp.breached(2, 4); !breached {
+			t.Fatal("expected 50% to breach threshold of 50%")
+		}
+	})
+}
+
+func Test_configuredOper_cancelsInFlightTasks(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		c    configuredOper
+		want bool
+	}{
+		{name: "default", c: configuredOper{}, want: false},
+		{name: "halt soon", c: configuredOper{halt: haltPolicy{when: haltSoon, fails: 1}}, want: false},
+		{name: "halt now", c: configuredOper{halt: haltPolicy{when: haltNow, fails: 1}}, want: true},
+		{name: "timeout", c: configuredOper{timeout: time.Second}, want: true},
+		{name: "hunt", c: configuredOper{hunt: &hunter{}}, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.c.cancelsInFlightTasks(); got != tc.want {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_configuredOper_run_halt(t *testing.T) {
+	t.Run("halt now should cancel in-flight tasks and stop the run", func(t *testing.T) {
+		amWorkers := 2
+		c := configuredOper{
+			am:      100,
+			workers: amWorkers,
+			// Worker 0's first task fails fast, everything else is slow
+			args:          []string{"sh", "-c", "[ INC -ne 0 ] && sleep 5"},
+			increment:     true,
+			halt:          haltPolicy{when: haltNow, fails: 1},
+			amIdleWorkers: amWorkers,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(amWorkers)
+
+		started := time.Now()
+		stats := c.run(context.Background())
+		if elapsed := time.Since(started); elapsed >= 3*time.Second {
+			t.Fatalf("expected halt to cancel in-flight tasks, got runtime: %v", elapsed)
+		}
+		if stats.haltReason == "" {
+			t.Fatal("expected halt reason to be set")
+		}
+		if stats.cancelled {
+			t.Fatal("expected halted run to not be reported as cancelled")
+		}
+		if !strings.Contains(stats.String(), "halted") {
+			t.Fatalf("expected statistics to report halt, got: %s", stats.String())
+		}
+	})
+
+	t.Run("halt soon should let in-flight tasks finish", func(t *testing.T) {
+		amWorkers := 2
+		c := configuredOper{
+			am:            100,
+			workers:       amWorkers,
+			args:          []string{"sh", "-c", "[ INC -ne 0 ] && sleep 0.2"},
+			increment:     true,
+			halt:          haltPolicy{when: haltSoon, fails: 1},
+			amIdleWorkers: amWorkers,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(amWorkers)
+
+		stats := c.run(context.Background())
+		if stats.haltReason == "" {
+			t.Fatal("expected halt reason to be set")
+		}
+		if stats.amCancelled != 0 {
+			t.Fatalf("expected in-flight tasks to finish, got: %v cancelled", stats.amCancelled)
+		}
+		if stats.amDone >= 100 {
+			t.Fatalf("expected run to stop early, got: %v tasks done", stats.amDone)
+		}
+	})
+}
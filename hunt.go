@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// huntConfidenceZ is the z-score of the 95% confidence interval of the failure rate
+const huntConfidenceZ = 1.96
+
+// hunter stops the run at the first failed attempt, or, if diffOutput is set, at the
+// first successful attempt whose output differs from the first successful one. The
+// divergent attempt is saved to a reproducer bundle.
+type hunter struct {
+	dir        string
+	diffOutput bool
+	// normalizer of the outputs before they're compared
+	normalizer outputNormalizer
+	// firstOutput of the first successful attempt, if diffOutput is set
+	firstOutput           string
+	firstNormalizedOutput string
+	hasFirstOutput        bool
+	amAttempts            int
+	amFailures            int
+	report                *huntReport
+}
+
+// huntReport of the divergent attempt which stopped the hunt, and the observed failure rate
+type huntReport struct {
+	Found    bool   `json:"found"`
+	Reason   string `json:"reason,omitempty"`
+	TaskIdx  int    `json:"taskIdx"`
+	Attempt  int    `json:"attempt"`
+	Attempts int    `json:"attempts"`
+	Failures int    `json:"failures"`
+	// RateLow and RateHigh is the 95% Wilson score interval of the failure rate
+	RateLow  float64 `json:"rateLow"`
+	RateHigh float64 `json:"rateHigh"`
+	Bundle   string  `json:"bundle,omitempty"`
+}
+
+// wilsonInterval of the rate of successes out of n trials, at the z-score
+func wilsonInterval(successes, n int, z float64) (float64, float64) {
+	if n == 0 {
+		return 0, 1
+	}
+	p := float64(successes) / float64(n)
+	nf := float64(n)
+	denominator := 1 + z*z/nf
+	center := (p + z*z/(2*nf)) / denominator
+	halfWidth := z * math.Sqrt(p*(1-p)/nf+z*z/(4*nf*nf)) / denominator
+	return max(center-halfWidth, 0), min(center+halfWidth, 1)
+}
+
+// checkHunt for the first divergent attempt. Once found, it's saved to the reproducer
+// bundle and the run is halted, cancelling the in-flight tasks.
+func (c *configuredOper) checkHunt(res Result) {
+	h := c.hunt
+	if h == nil || res.IsCancelled || h.report != nil {
+		return
+	}
+	h.amAttempts++
+	var reason, expected string
+	switch {
+	case res.isFailure():
+		reason = fmt.Sprintf("task: %v, attempt: %v, failed", res.Idx, res.Attempt)
+	case h.diffOutput && !h.hasFirstOutput:
+		h.firstOutput = res.Output
+		h.firstNormalizedOutput = h.normalizer.normalize(res.Output)
+		h.hasFirstOutput = true
+	case h.diffOutput && h.normalizer.normalize(res.Output) != h.firstNormalizedOutput:
+		reason = fmt.Sprintf("task: %v, attempt: %v, output differs from the first successful output", res.Idx, res.Attempt)
+		expected = h.firstOutput
+	}
+	if reason == "" {
+		return
+	}
+	h.amFailures++
+	h.report = &huntReport{
+		Found:   true,
+		Reason:  reason,
+		TaskIdx: res.Idx,
+		Attempt: res.Attempt,
+		Bundle:  h.dir,
+	}
+	if err := c.writeHuntBundle(res, expected); err != nil {
+		printErr(fmt.Sprintf("failed to write reproducer bundle: %v\n", err))
+		h.report.Bundle = ""
+	} else {
+		printOK(fmt.Sprintf("reproducer bundle written to: %v\n", h.dir))
+	}
+	c.haltRun("hunt found divergence, "+reason, true)
+}
+
+// summary of the hunt, with the observed failure rate
+func (h *hunter) summary() *huntReport {
+	if h == nil {
+		return nil
+	}
+	report := huntReport{}
+	if h.report != nil {
+		report = *h.report
+	}
+	report.Attempts = h.amAttempts
+	report.Failures = h.amFailures
+	report.RateLow, report.RateHigh = wilsonInterval(h.amFailures, h.amAttempts, huntConfidenceZ)
+	return &report
+}
+
+// writeHuntBundle of the divergent attempt, with everything needed to reproduce it: the
+// expanded command, the environment added by repeater, the full output and the seed
+func (c *configuredOper) writeHuntBundle(res Result, expected string) error {
+	if err := os.MkdirAll(c.hunt.dir, 0o755); err != nil {
+		return err
+	}
+	env, err := c.taskEnv(res.Idx, res.WorkerID, res.Attempt)
+	if err != nil {
+		return err
+	}
+	resBytes, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return err
+	}
+	output := res.Output
+	if res.OutputFile != "" {
+		// The output of the result was truncated, so use the full output
+		if b, err := os.ReadFile(res.OutputFile); err == nil {
+			output = string(b)
+		}
+	}
+	files := map[string]string{
+		"command":      res.Command + "\n",
+		"env":          strings.Join(env, "\n") + "\n",
+		"output":       output,
+		"stdout":       eventsText(res.Stdout),
+		"stderr":       eventsText(res.Stderr),
+		"result.json":  string(resBytes) + "\n",
+		"reproduce.sh": c.reproduceScript(res, env),
+	}
+	if expected != "" {
+		files["expected_output"] = expected
+	}
+	for name, content := range files {
+		mode := os.FileMode(0o644)
+		if name == "reproduce.sh" {
+			mode = 0o755
+		}
+		if err := os.WriteFile(filepath.Join(c.hunt.dir, name), []byte(content), mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reproduceScript which runs the argv of the attempt in the same directory, with the
+// same environment added
+func (c *configuredOper) reproduceScript(res Result, env []string) string {
+	var sb strings.Builder
+	sb.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&sb, "# Reproduces task: %v, attempt: %v, of run: %v, with seed: %v\n", res.Idx, res.Attempt, c.runID, c.seed)
+	if wd, err := os.Getwd(); err == nil {
+		fmt.Fprintf(&sb, "cd %v || exit 1\n", shellQuote(wd))
+	}
+	for _, e := range env {
+		key, value, _ := strings.Cut(e, "=")
+		fmt.Fprintf(&sb, "export %v=%v\n", key, shellQuote(value))
+	}
+	// The full argv, as the command line of shell mode lacks the shell which runs it
+	sb.WriteString(quoteArgv(res.Argv) + "\n")
+	return sb.String()
+}
+
+func huntString(report *huntReport) string {
+	if report == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n== Hunt ==\n")
+	if report.Found {
+		fmt.Fprintf(&sb, "Found divergence after %v attempts, %v\n", report.Attempts, report.Reason)
+	} else {
+		fmt.Fprintf(&sb, "No divergence found in %v attempts\n", report.Attempts)
+	}
+	rate := 0.0
+	if report.Attempts > 0 {
+		rate = float64(report.Failures) / float64(report.Attempts)
+	}
+	fmt.Fprintf(&sb, "Observed failure rate: %v/%v (%.2f%%), 95%% confidence interval: [%.2f%%, %.2f%%]",
+		report.Failures, report.Attempts, rate*100, report.RateLow*100, report.RateHigh*100)
+	if report.Bundle != "" {
+		fmt.Fprintf(&sb, "\nReproducer bundle: %v", report.Bundle)
+	}
+	return sb.String()
+}
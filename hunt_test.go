@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_wilsonInterval(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		successes int
+		n         int
+		wantLow   float64
+		wantHigh  float64
+	}{
+		{name: "no trials", successes: 0, n: 0, wantLow: 0, wantHigh: 1},
+		{name: "no successes", successes: 0, n: 100, wantLow: 0, wantHigh: 0.0370},
+		{name: "some successes", successes: 1, n: 100, wantLow: 0.0018, wantHigh: 0.0545},
+		{name: "half", successes: 50, n: 100, wantLow: 0.4038, wantHigh: 0.5962},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			low, high := wilsonInterval(tc.successes, tc.n, huntConfidenceZ)
+			if math.Abs(low-tc.wantLow) > 0.0001 || math.Abs(high-tc.wantHigh) > 0.0001 {
+				t.Fatalf("expected: [%v, %v], got: [%v, %v]", tc.wantLow, tc.wantHigh, low, high)
+			}
+		})
+	}
+}
+
+func Test_configuredOper_run_hunt(t *testing.T) {
+	t.Run("it should stop at the first failure and write the bundle", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "bundle")
+		amWorkers := 2
+		c := configuredOper{
+			am:      100,
+			workers: amWorkers,
+			// Task 3 fails fast, the tasks after it are slow
+			args:          []string{"sh", "-c", `[ $REPEATER_TASK_IDX -eq 3 ] && exit 1; [ $REPEATER_TASK_IDX -gt 3 ] && sleep 5; echo ok`},
+			hunt:          &hunter{dir: dir},
+			amIdleWorkers: amWorkers,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(amWorkers)
+
+		started := time.Now()
+		stats := c.run(context.Background())
+		if elapsed := time.Since(started); elapsed >= 3*time.Second {
+			t.Fatalf("expected hunt to cancel in-flight tasks, got runtime: %v", elapsed)
+		}
+		if stats.hunt == nil || !stats.hunt.Found || stats.hunt.TaskIdx != 3 {
+			t.Fatalf("expected hunt to find task 3, got: %+v", stats.hunt)
+		}
+		if stats.hunt.Failures != 1 || stats.hunt.RateHigh <= stats.hunt.RateLow {
+			t.Fatalf("unexpected failure rate: %+v", stats.hunt)
+		}
+		if got := stats.exitCode(); got != exitTaskFailure {
+			t.Fatalf("expected exit code: %v, got: %v", exitTaskFailure, got)
+		}
+		for _, name := range []string{"command", "env", "output", "stdout", "stderr", "result.json", "reproduce.sh"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+				t.Fatalf("expected bundle file: %v, got: %v", name, err)
+			}
+		}
+		script, err := os.ReadFile(filepath.Join(dir, "reproduce.sh"))
+		if err != nil {
+			t.Fatalf("failed to read reproduce.sh: %v", err)
+		}
+		if !strings.Contains(string(script), "export REPEATER_TASK_IDX=3") {
+			t.Fatalf("expected reproduce.sh to set the task index, got: %s", script)
+		}
+		if !strings.Contains(stats.String(), "Reproducer bundle: "+dir) {
+			t.Fatalf("expected statistics to report the bundle, got: %s", stats.String())
+		}
+	})
+
+	t.Run("it should reproduce with the shell of shell mode", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "bundle")
+		c := configuredOper{
+			am:            1,
+			args:          []string{"/bin/sh", "-e", "-c", `echo "$REPEATER_TASK_IDX" >"$OUT"; false; exit 0`},
+			shell:         true,
+			hunt:          &hunter{dir: dir},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+		t.Setenv("OUT", filepath.Join(t.TempDir(), "out"))
+
+		stats := c.run(context.Background())
+		if stats.hunt == nil || !stats.hunt.Found {
+			t.Fatalf("expected hunt to find the failure of '-e', got: %+v", stats.hunt)
+		}
+		script := filepath.Join(dir, "reproduce.sh")
+		if err := exec.Command(script).Run(); err == nil {
+			t.Fatal("expected reproduce.sh to fail like the attempt, as it runs the same shell")
+		}
+		if b, err := os.ReadFile(os.Getenv("OUT")); err != nil || string(b) != "0\n" {
+			t.Fatalf("expected reproduce.sh to run the command line, got: %q, err: %v", b, err)
+		}
+	})
+
+	t.Run("it should stop at the first divergent output", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "bundle")
+		c := configuredOper{
+			am:            10,
+			args:          []string{"sh", "-c", `[ $REPEATER_TASK_IDX -ge 5 ] && echo other || echo same`},
+			hunt:          &hunter{dir: dir, diffOutput: true},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+
+		stats := c.run(context.Background())
+		if stats.hunt == nil || !stats.hunt.Found || stats.hunt.TaskIdx != 5 {
+			t.Fatalf("expected hunt to find task 5, got: %+v", stats.hunt)
+		}
+		expected, err := os.ReadFile(filepath.Join(dir, "expected_output"))
+		if err != nil || string(expected) != "same\n" {
+			t.Fatalf("expected the first output to be kept, got: %q, err: %v", expected, err)
+		}
+	})
+
+	t.Run("it should compare normalized outputs", func(t *testing.T) {
+		normalizer, _ := parseNormalizeRules([]string{"number"})
+		c := configuredOper{
+			am:            5,
+			args:          []string{"sh", "-c", `echo "task $REPEATER_TASK_IDX"`},
+			hunt:          &hunter{dir: t.TempDir(), diffOutput: true, normalizer: normalizer},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+
+		stats := c.run(context.Background())
+		if stats.hunt == nil || stats.hunt.Found {
+			t.Fatalf("expected outputs which only differ by numbers to be equal, got: %+v", stats.hunt)
+		}
+	})
+
+	t.Run("it should report the rate when nothing is found", func(t *testing.T) {
+		c := configuredOper{
+			am:            5,
+			args:          []string{"true"},
+			hunt:          &hunter{dir: t.TempDir()},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+
+		stats := c.run(context.Background())
+		if stats.hunt == nil || stats.hunt.Found || stats.hunt.Attempts != 5 {
+			t.Fatalf("expected 5 attempts without divergence, got: %+v", stats.hunt)
+		}
+		if got := stats.exitCode(); got != exitOK {
+			t.Fatalf("expected exit code: %v, got: %v", exitOK, got)
+		}
+	})
+}
+
+func Test_configuredOper_New_hunt(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{huntOutput: true})
+	if err == nil || !strings.Contains(err.Error(), "hunt") {
+		t.Fatalf("expected error for huntOutput without hunt, got: %v", err)
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{hunt: true})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.hunt == nil || c.hunt.dir != "repeater-hunt-"+c.runID {
+		t.Fatalf("expected default hunt dir, got: %+v", c.hunt)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/baalimago/repeater/pkg/filetools"
+)
+
+const (
+	linePlaceholder = "{}"
+	// stdinInput is the input path which reads lines from stdin
+	stdinInput = "-"
+)
+
+// readInputLines from the file at path, or from stdin if path is '-'
+func readInputLines(path string) ([]string, error) {
+	if path == stdinInput {
+		return filetools.ReadLines(os.Stdin)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer f.Close()
+	return filetools.ReadLines(f)
+}
+
+// replaceLine by replacing the line placeholder with the input line of the task.
+// If no argument contains the placeholder, the line is appended as the last argument,
+// same as xargs. In shell mode, the line is quoted and appended to the command line instead.
+func (c *configuredOper) replaceLine(args []string, i int) []string {
+	if c.lines == nil {
+		return args
+	}
+	if !containsPlaceholder(args, linePlaceholder) {
+		if c.shell {
+			newArgs := append([]string{}, args...)
+			newArgs[len(newArgs)-1] += " " + shellQuote(c.lines[i])
+			return newArgs
+		}
+		return append(append([]string{}, args...), c.lines[i])
+	}
+	return c.replaceLinePlaceholder(args, i, c.quoteArg)
+}
+
+// replaceLinePlaceholder with the input line of the task, quoted by quote unless it's nil,
+// without appending the line if there is no placeholder
+func (c *configuredOper) replaceLinePlaceholder(args []string, i int, quote func(string) string) []string {
+	if c.lines == nil {
+		return args
+	}
+	line := c.lines[i]
+	if quote != nil {
+		line = quote(line)
+	}
+	newArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		newArgs = append(newArgs, strings.ReplaceAll(arg, linePlaceholder, line))
+	}
+	return newArgs
+}
+
+func containsPlaceholder(args []string, placeholder string) bool {
+	for _, arg := range args {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_configuredOper_replaceLine(t *testing.T) {
+	c := configuredOper{lines: []string{"first", "second line"}}
+
+	t.Run("it should replace the placeholder with the line of the task", func(t *testing.T) {
+		got := c.replaceLine([]string{"-d", "user={}&id={}"}, 1)
+		want := []string{"-d", "user=second line&id=second line"}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+
+	t.Run("it should append the line as last argument if there is no placeholder", func(t *testing.T) {
+		args := []string{"-n"}
+		got := c.replaceLine(args, 0)
+		want := []string{"-n", "first"}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+		if len(args) != 1 {
+			t.Fatalf("expected original args to be untouched, got: %q", args)
+		}
+	})
+
+	t.Run("it should leave args untouched without input", func(t *testing.T) {
+		c := configuredOper{}
+		args := []string{"{}"}
+		if got := c.replaceLine(args, 0); !slices.Equal(got, args) {
+			t.Fatalf("expected: %q, got: %q", args, got)
+		}
+	})
+}
+
+func Test_configuredOper_New_input(t *testing.T) {
+	inputPath := fmt.Sprintf("%v/input", t.TempDir())
+	if err := os.WriteFile(inputPath, []byte("a\nb\nc\n"), 0o644); err != nil {
+		t.Fatalf("failed to write input file: %v", err)
+	}
+	args := []string{"echo", "{}"}
+
+	t.Run("it should default the amount of repetitions to the amount of lines", func(t *testing.T) {
+		c, err := New(0, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{input: inputPath})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if c.am != 3 {
+			t.Fatalf("expected: 3, got: %v", c.am)
+		}
+	})
+
+	t.Run("it should return error if more repetitions than lines are requested", func(t *testing.T) {
+		_, err := New(4, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{input: inputPath})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+
+	t.Run("it should return error if input from stdin would conflict with asking about existing files", func(t *testing.T) {
+		stdin, err := os.Open(inputPath)
+		if err != nil {
+			t.Fatalf("failed to open input file: %v", err)
+		}
+		defer stdin.Close()
+		origStdin := os.Stdin
+		os.Stdin = stdin
+		defer func() { os.Stdin = origStdin }()
+		resultPath := fmt.Sprintf("%v/results.json", t.TempDir())
+		if err := os.WriteFile(resultPath, []byte("[]"), 0o644); err != nil {
+			t.Fatalf("failed to write result file: %v", err)
+		}
+
+		_, err = New(0, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, resultPath, false, false, runOptions{input: stdinInput, dryRun: true})
+		if err == nil || !strings.Contains(err.Error(), "fileMode") {
+			t.Fatalf("expected error asking for fileMode, got: %v", err)
+		}
+		c, err := New(0, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "a", false, resultPath, false, false, runOptions{input: stdinInput, dryRun: true})
+		if err != nil {
+			t.Fatalf("expected nil with fileMode set, got: %v", err)
+		}
+		if c.am != 3 {
+			t.Fatalf("expected the lines to be read from stdin, got: %v", c.am)
+		}
+	})
+
+	t.Run("it should return error if the input file doesn't exist", func(t *testing.T) {
+		_, err := New(0, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{input: inputPath + "-nope"})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func Test_configuredOper_run_input(t *testing.T) {
+	lines := []string{"alpha", "beta", "gamma"}
+	c := configuredOper{
+		am:            len(lines),
+		args:          []string{"printf", "%s", "{}"},
+		lines:         lines,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+
+	for _, r := range stats.Results {
+		if r.Output != lines[r.Idx] || r.Input != lines[r.Idx] {
+			t.Fatalf("expected output and input: %q for task: %v, got output: %q, input: %q", lines[r.Idx], r.Idx, r.Output, r.Input)
+		}
+	}
+	if len(stats.Results) != len(lines) {
+		t.Fatalf("expected: %v results, got: %v", len(lines), len(stats.Results))
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reportedPercentiles of the runtime of successful attempts
+var reportedPercentiles = []float64{50, 90, 95, 99, 99.9}
+
+// defaultHistogramBuckets is the amount of equally wide buckets of the histogram
+const defaultHistogramBuckets = 10
+
+// histogramBarWidth is the width of the longest bar of the rendered histogram
+const histogramBarWidth = 40
+
+type percentile struct {
+	Percent float64       `json:"percent"`
+	Runtime time.Duration `json:"runtime"`
+}
+
+type histogramBucket struct {
+	From time.Duration `json:"from"`
+	// To is exclusive, except for the last bucket of equally wide buckets. It's 0 for the
+	// last bucket of explicit bounds, which is unbounded.
+	To    time.Duration `json:"to"`
+	Count int           `json:"count"`
+}
+
+// histogramSpec configures the buckets of the histogram, either as an amount of equally
+// wide buckets between the min and max runtime, or as explicit bounds
+type histogramSpec struct {
+	amBuckets int
+	bounds    []time.Duration
+}
+
+// parseHistogramBuckets on the format '<amount>', such as '10', or '<bound>,<bound>,...',
+// such as '10ms,50ms,1s'. Empty means the default amount of buckets.
+func parseHistogramBuckets(s string) (histogramSpec, error) {
+	if s == "" {
+		return histogramSpec{amBuckets: defaultHistogramBuckets}, nil
+	}
+	if am, err := strconv.Atoi(s); err == nil {
+		if am < 1 {
+			return histogramSpec{}, fmt.Errorf("amount of histogram buckets must be at least 1, got: %v", am)
+		}
+		return histogramSpec{amBuckets: am}, nil
+	}
+	var bounds []time.Duration
+	for _, boundStr := range strings.Split(s, ",") {
+		bound, err := time.ParseDuration(strings.TrimSpace(boundStr))
+		if err != nil {
+			return histogramSpec{}, fmt.Errorf("failed to parse histogram bound: %q, expected an amount, such as '10', or durations, such as '10ms,50ms,1s': %w", boundStr, err)
+		}
+		if len(bounds) > 0 && bound <= bounds[len(bounds)-1] {
+			return histogramSpec{}, errors.New("histogram bounds must be increasing")
+		}
+		bounds = append(bounds, bound)
+	}
+	return histogramSpec{bounds: bounds}, nil
+}
+
+// calcPercentiles of the sorted runtimes, using the nearest rank
+func calcPercentiles(sorted []time.Duration) []percentile {
+	if len(sorted) == 0 {
+		return nil
+	}
+	ret := make([]percentile, 0, len(reportedPercentiles))
+	for _, p := range reportedPercentiles {
+		// Subtract a tiny amount so that floating point errors don't bump the rank
+		rank := int(math.Ceil(p*float64(len(sorted))/100 - 1e-9))
+		ret = append(ret, percentile{Percent: p, Runtime: sorted[max(rank, 1)-1]})
+	}
+	return ret
+}
+
+// histogram of the sorted runtimes
+func (hs histogramSpec) histogram(sorted []time.Duration) []histogramBucket {
+	if len(sorted) == 0 {
+		return nil
+	}
+	var buckets []histogramBucket
+	if len(hs.bounds) > 0 {
+		buckets = boundedBuckets(hs.bounds)
+	} else {
+		buckets = equalWidthBuckets(sorted[0], sorted[len(sorted)-1], hs.amBuckets)
+	}
+	bucketIdx := 0
+	for _, d := range sorted {
+		for bucketIdx < len(buckets)-1 && d >= buckets[bucketIdx].To {
+			bucketIdx++
+		}
+		buckets[bucketIdx].Count++
+	}
+	return buckets
+}
+
+// boundedBuckets from 0 to each bound, with an unbounded last bucket
+func boundedBuckets(bounds []time.Duration) []histogramBucket {
+	buckets := make([]histogramBucket, 0, len(bounds)+1)
+	from := time.Duration(0)
+	for _, bound := range bounds {
+		buckets = append(buckets, histogramBucket{From: from, To: bound})
+		from = bound
+	}
+	return append(buckets, histogramBucket{From: from})
+}
+
+// equalWidthBuckets between minDur and maxDur, where the last bucket includes maxDur.
+// There are never more buckets than nanoseconds in the range, so equal runtimes get one bucket.
+func equalWidthBuckets(minDur, maxDur time.Duration, amBuckets int) []histogramBucket {
+	if amBuckets < 1 {
+		amBuckets = defaultHistogramBuckets
+	}
+	amBuckets = int(min(time.Duration(amBuckets), maxDur-minDur+1))
+	width := max((maxDur-minDur)/time.Duration(amBuckets), 1)
+	buckets := make([]histogramBucket, 0, amBuckets)
+	for i := 0; i < amBuckets; i++ {
+		buckets = append(buckets, histogramBucket{From: minDur + time.Duration(i)*width, To: minDur + time.Duration(i+1)*width})
+	}
+	buckets[len(buckets)-1].To = maxDur
+	return buckets
+}
+
+// bucketIdxOf the runtime. Runtimes beyond the last bucket are counted in it.
+func bucketIdxOf(buckets []histogramBucket, d time.Duration) int {
+	idx, _ := slices.BinarySearchFunc(buckets, d, func(b histogramBucket, d time.Duration) int {
+		if b.To != 0 && b.To <= d {
+			return -1
+		}
+		return 1
+	})
+	return min(idx, len(buckets)-1)
+}
+
+// sortedRuntimes of the successful attempts
+func sortedRuntimes(results []Result) []time.Duration {
+	ret := make([]time.Duration, 0, len(results))
+	for _, r := range results {
+		if r.isFailure() || r.IsCancelled {
+			continue
+		}
+		ret = append(ret, r.Runtime)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// percentileOf returns the runtime at the percent, or 0 if it's not reported
+func percentileOf(percentiles []percentile, percent float64) time.Duration {
+	for _, p := range percentiles {
+		if p.Percent == percent {
+			return p.Runtime
+		}
+	}
+	return 0
+}
+
+func estimatedString(estimated bool) string {
+	if estimated {
+		return " (estimated)"
+	}
+	return ""
+}
+
+func percentilesString(percentiles []percentile) string {
+	parts := make([]string, 0, len(percentiles))
+	for _, p := range percentiles {
+		parts = append(parts, fmt.Sprintf("p%v: %v", p.Percent, p.Runtime))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// histogramString renders the histogram as a bar chart
+func histogramString(buckets []histogramBucket) string {
+	if len(buckets) == 0 {
+		return ""
+	}
+	maxCount := 0
+	labels := make([]string, 0, len(buckets))
+	labelWidth := 0
+	for _, b := range buckets {
+		maxCount = max(maxCount, b.Count)
+		to := b.To.String()
+		if b.To == 0 {
+			to = "inf"
+		}
+		label := fmt.Sprintf("%v - %v", b.From, to)
+		labelWidth = max(labelWidth, len(label))
+		labels = append(labels, label)
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n== Histogram ==")
+	for i, b := range buckets {
+		barLen := 0
+		if maxCount > 0 {
+			barLen = int(math.Round(float64(b.Count) / float64(maxCount) * histogramBarWidth))
+		}
+		fmt.Fprintf(&sb, "\n%*s | %-*s %v", labelWidth, labels[i], histogramBarWidth, strings.Repeat("#", barLen), b.Count)
+	}
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseHistogramBuckets(t *testing.T) {
+	got, err := parseHistogramBuckets("")
+	if err != nil || got.amBuckets != defaultHistogramBuckets {
+		t.Fatalf("expected default amount of buckets, got: %+v, err: %v", got, err)
+	}
+	got, err = parseHistogramBuckets("5")
+	if err != nil || got.amBuckets != 5 {
+		t.Fatalf("expected 5 buckets, got: %+v, err: %v", got, err)
+	}
+	got, err = parseHistogramBuckets("10ms, 50ms,1s")
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	want := []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, time.Second}
+	if !slices.Equal(got.bounds, want) {
+		t.Fatalf("expected: %v, got: %v", want, got.bounds)
+	}
+	for _, given := range []string{"0", "-1", "10ms,5ms", "fast"} {
+		if _, err := parseHistogramBuckets(given); err == nil {
+			t.Fatalf("for: %q, expected error, got nil", given)
+		}
+	}
+}
+
+func millis(ms ...int) []time.Duration {
+	ret := make([]time.Duration, 0, len(ms))
+	for _, m := range ms {
+		ret = append(ret, time.Duration(m)*time.Millisecond)
+	}
+	return ret
+}
+
+func Test_calcPercentiles(t *testing.T) {
+	sorted := make([]time.Duration, 0, 1000)
+	for i := 1; i <= 1000; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+	got := calcPercentiles(sorted)
+	want := []percentile{
+		{50, 500 * time.Millisecond},
+		{90, 900 * time.Millisecond},
+		{95, 950 * time.Millisecond},
+		{99, 990 * time.Millisecond},
+		{99.9, 999 * time.Millisecond},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected: %v, got: %v", want, got)
+	}
+	if got := calcPercentiles(millis(7)); got[0].Runtime != 7*time.Millisecond || got[4].Runtime != 7*time.Millisecond {
+		t.Fatalf("expected single runtime for every percentile, got: %v", got)
+	}
+	if got := calcPercentiles(nil); got != nil {
+		t.Fatalf("expected nil, got: %v", got)
+	}
+}
+
+func Test_histogramSpec_histogram(t *testing.T) {
+	t.Run("it should count into equally wide buckets, including the max", func(t *testing.T) {
+		got := histogramSpec{amBuckets: 2}.histogram(millis(0, 1, 2, 3, 4))
+		want := []histogramBucket{
+			{From: 0, To: 2 * time.Millisecond, Count: 2},
+			{From: 2 * time.Millisecond, To: 4 * time.Millisecond, Count: 3},
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("it should count into explicit bounds, with an unbounded last bucket", func(t *testing.T) {
+		got := histogramSpec{bounds: millis(10, 50)}.histogram(millis(1, 10, 20, 49, 50, 500))
+		counts := []int{}
+		for _, b := range got {
+			counts = append(counts, b.Count)
+		}
+		if want := []int{1, 3, 2}; !slices.Equal(counts, want) {
+			t.Fatalf("expected counts: %v, got: %v", want, counts)
+		}
+		if got[2].To != 0 {
+			t.Fatalf("expected last bucket to be unbounded, got: %v", got[2])
+		}
+	})
+
+	t.Run("it should use one bucket for equal runtimes", func(t *testing.T) {
+		got := histogramSpec{amBuckets: 3}.histogram(millis(5, 5, 5))
+		want := []histogramBucket{{From: 5 * time.Millisecond, To: 5 * time.Millisecond, Count: 3}}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("it should use one bucket for a single runtime", func(t *testing.T) {
+		got := histogramSpec{amBuckets: 3}.histogram(millis(7))
+		want := []histogramBucket{{From: 7 * time.Millisecond, To: 7 * time.Millisecond, Count: 1}}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %v, got: %v", want, got)
+		}
+	})
+
+	t.Run("it should not use more buckets than nanoseconds in the range", func(t *testing.T) {
+		got := histogramSpec{amBuckets: 10}.histogram([]time.Duration{100, 101, 102})
+		want := []histogramBucket{{From: 100, To: 101, Count: 1}, {From: 101, To: 102, Count: 1}, {From: 102, To: 102, Count: 1}}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %v, got: %v", want, got)
+		}
+	})
+}
+
+func Test_histogramString(t *testing.T) {
+	got := histogramString([]histogramBucket{
+		{From: 0, To: time.Millisecond, Count: 1},
+		{From: time.Millisecond, Count: 2},
+	})
+	for _, want := range []string{"== Histogram ==", "1ms - inf", strings.Repeat("#", histogramBarWidth) + " 2"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected: %q, to contain: %q", got, want)
+		}
+	}
+}
+
+func Test_statistics_format(t *testing.T) {
+	results := []Result{
+		{Idx: 0, Runtime: 10 * time.Millisecond},
+		{Idx: 1, Runtime: 20 * time.Millisecond},
+		{Idx: 2, Runtime: 30 * time.Millisecond, IsError: true},
+	}
+	c := configuredOper{am: 3, results: results, histogram: histogramSpec{amBuckets: 2}}
+	stats := c.calcStats()
+	if !strings.Contains(stats.format(statisticsFormatText), "p50: 10ms") {
+		t.Fatalf("expected percentiles in text, got: %v", stats.format(statisticsFormatText))
+	}
+	var got statisticsSummary
+	if err := json.Unmarshal([]byte(stats.format(statisticsFormatJSON)), &got); err != nil {
+		t.Fatalf("expected valid json, got err: %v", err)
+	}
+	if got.Completed != 3 || got.Failures != 1 || len(got.Histogram) != 2 || got.Percentiles[4].Runtime != 20*time.Millisecond {
+		t.Fatalf("unexpected summary: %+v", got)
+	}
+}
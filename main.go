@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"slices"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,26 +16,96 @@ import (
 	"github.com/baalimago/repeater/internal/output"
 )
 
-const DefaultProgressFormat = "\rProgress: (Success/Fail/Requested Am)(%v/%v/%v), Start at: %v, Remaining: %s, Est. done at: %v"
+const (
+	DefaultProgressFormat         = "\rProgress: (Success/Fail/Requested Am)(%v/%v/%v), Start at: %v, Remaining: %s, Est. done at: %v"
+	DefaultDurationProgressFormat = "\rProgress: (Success/Fail)(%v/%v), Elapsed: %v, Start at: %v, Remaining: %s, Est. done at: %v"
+)
+
+var (
+	amRunsFlag           = flag.Int("n", 1, "Amount of times you wish to repeat the command.")
+	verboseFlag          = flag.Bool("v", false, "Set to display the configured operation before running")
+	workersFlag          = flag.Int("w", 1, "Set the amout of workers to repeat the command with. Having more than 1 makes execution paralell. Expect performance diminishing returns when approaching CPU threads.")
+	colorFlag            = flag.Bool("nocolor", false, "Set to true to disable ansi-colored output")
+	progressFlag         = flag.String("progress", "STDOUT", "Options are: ['HIDDEN', 'FILE', 'STDOUT', 'BOTH']")
+	progressFormatFlag   = flag.String("progressFormat", DefaultProgressFormat, "Set the format for the output where 1st arg is the iteration and 2d arg is the amount of runs, 3d total (elapsed time if 'duration' or 'until' is set), 4th start, 5th countdown (human-readable, e.g. '1d 2h 3m 4s'), 6th est completion time.")
+	outputFlag           = flag.String("output", "HIDDEN", "Options are: ['HIDDEN', 'FILE', 'STDOUT', 'BOTH']")
+	outputFormatFlag     = flag.String("outputFormat", outputFormatV1, "Options are: ['v1', 'v2']")
+	fileFlag             = flag.String("file", "", "Path to the file where the report will be saved, configure file conflicts automatically with 'fileMode'")
+	fileModeFlag         = flag.String("fileMode", "", "Configure how the report file, and the result file, should be treated. If a file exists, and this option isn't set, user will be queried. Options are: ['t'runcate, 'a'ppend] ")
+	statisticsFlag       = flag.Bool("statistics", true, "Set to true if you don't wish to see statistics of the repeated command.")
+	incrementFlag        = flag.Bool("increment", false, "Set to true and add an argument 'INC', to have 'INC' be replaced with the iteration. If increment == true && 'INC' is not set, repeater will panic. Shorthand for '{{.Idx}}' with 'template'.")
+	resultFlag           = flag.String("result", "", "Set this to some filename and get a json-formated output of all the performed tasks. This output is the basis of the statistics.")
+	resultFormatFlag     = flag.String("resultFormat", resultFormatJSON, "Format of the 'result' file. Options are: ['json', 'jsonl']. 'json' writes one array once the run is done, 'jsonl' appends one result per line as soon as each task is done, so that interrupted runs are preserved and the file may be tailed.")
+	retryOnFailFlag      = flag.Bool("retryOnFail", false, "Set to true to retry failed commands, effectively making repeate run until all commands are successful. Retries are made on the same task index. Limit the amount of attempts with 'maxAttempts'.")
+	maxAttemptsFlag      = flag.Int("maxAttempts", 1, "Amount of times each command is attempted before it's considered failed, including the first attempt. Retries are made on the same task index.")
+	backoffFlag          = flag.String("backoff", string(backoffConst), "Strategy for the delay between attempts, which is capped at 24h. Options are: ['const', 'linear', 'exp']")
+	backoffBaseFlag      = flag.Duration("backoffBase", 0, "The delay between attempts which 'backoff' is based on, such as '100ms'.")
+	backoffJitterFlag    = flag.Float64("backoffJitter", 0, "Fraction, within [0, 1], which the delay between attempts is randomly adjusted by.")
+	exitZeroFlag         = flag.Bool("exitZero", false, "Set to true to always exit with status 0 once the run is done, regardless of its outcome. See README for the exit codes.")
+	outputOnSuccessFlag  = flag.Bool("outputOnSuccess", true, "Set to false if you don't wish to see output on success")
+	durationFlag         = flag.Duration("duration", 0, "Keep repeating the command for this long, such as '10m', instead of '-n' amount of times. In-flight commands are allowed to finish once the time is up.")
+	untilFlag            = flag.String("until", "", "Keep repeating the command until this RFC3339 timestamp, such as '2026-10-19T06:00:00Z', instead of '-n' amount of times. In-flight commands are allowed to finish once the time is up.")
+	timeoutFlag          = flag.Duration("timeout", 0, "Kill each command, including any processes it has started, if it runs for longer than this, such as '30s'. Killed commands are reported as timeouts.")
+	haltFlag             = flag.String("halt", "never", "Halt the run when tasks fail. Format is '<when>,fail=<threshold>', where when is 'soon' to let in-flight commands finish, or 'now' to cancel them. Threshold is an amount of failed tasks, such as '1', or a percentage of finished tasks, such as '10%'. A halted run exits with a non-zero status.")
+	inputFlag            = flag.String("input", "", "Path to a file where each line is the input of one task, '-' to read from stdin. The line replaces '{}' in the arguments, or is appended as the last argument if there is no '{}'. Unless '-n' is set, the amount of repetitions is the amount of lines. When reading from stdin, 'fileMode' must be set if the report or result file already exists.")
+	paramsFlag           = flag.String("params", "", "Path to a csv file, or tsv if the extension is '.tsv', where the header row names parameters and each following row holds the parameters of one task. A parameter is referenced in the arguments as '{{<name>}}'. Unless '-n' is set, the amount of repetitions is the amount of rows.")
+	paramsCycleFlag      = flag.Bool("paramsCycle", false, "Set to true to cycle through the rows of 'params' when they run out. By default, the run stops once every row has been used.")
+	templateFlag         = flag.Bool("template", false, "Set to true to expand the arguments as Go text/template, such as '{{.Idx}}' or '{{pad 5 (add .Idx 1000)}}'. See README for the available fields and functions.")
+	seedFlag             = flag.Int64("seed", 0, "Seed of the random values available to templates, such as '{{.Rand}}'. Set to reproduce the values of a previous run. 0 picks a seed based on the time.")
+	shellFlag            = flag.Bool("shell", false, "Set to true to join the arguments into one command line which is run by 'shellCommand', allowing pipes, redirects and '&&'. Substituted values are quoted for the shell, so placeholders should not be quoted.")
+	shellCommandFlag     = flag.String("shellCommand", DefaultShellCommand, "The shell which runs the command line in 'shell' mode. The command line is appended as the last argument.")
+	histogramFlag        = flag.String("histogramBuckets", "", "Buckets of the runtime histogram in the statistics. Either an amount of equally wide buckets, such as '20', or bounds, such as '10ms,50ms,100ms,1s'. Defaults to 10 buckets.")
+	statisticsFormatFlag = flag.String("statisticsFormat", statisticsFormatText, "Format of the statistics. Options are: ['text', 'json']")
+	lowMemoryFlag        = flag.Bool("lowMemory", false, "Set to true to not keep the results in memory, so that long runs use constant memory. Statistics are aggregated as tasks finish, with estimated percentiles. Combine with '-resultFormat jsonl' to spill the results to disk.")
+	maxOutputFlag        = flag.String("maxOutput", "", "Maximum amount of output to keep of each command, such as '64KiB' or '1MB'. Output beyond this is cut according to 'maxOutputKeep', and the result is marked as truncated. Unlimited by default.")
+	maxOutputKeepFlag    = flag.String("maxOutputKeep", string(keepBoth), "The part of the output to keep when it exceeds 'maxOutput'. Options are: ['head', 'tail', 'both']")
+	outputSpillDirFlag   = flag.String("outputSpillDir", "", "Directory where the full output of each command exceeding 'maxOutput' is written. The file is referenced by the result as 'outputFile'.")
+	outputDirFlag        = flag.String("outputDir", "", "Directory of each task, where its stdout and stderr are written to the files 'stdout' and 'stderr'. It's a template which may contain the same placeholders as the arguments, such as './runs/{{.Idx}}'. Retries are written to 'stdout.<attempt>' and 'stderr.<attempt>'.")
+	outputDirMetaFlag    = flag.Bool("outputDirMeta", false, "Set to true to also write the result of each task, without its output, to 'meta.json' in its outputDir.")
+	tagFlag              = flag.Bool("tag", false, "Set to true to prefix each output line with the tag of its task, so that the output of several workers may be told apart.")
+	tagFormatFlag        = flag.String("tagFormat", DefaultTagFormat, "Template of the tag which prefixes each output line when 'tag' is set. It may contain the same placeholders as the arguments.")
+	tagColorFlag         = flag.Bool("tagColor", false, "Set to true to color the tag of each output line by worker. Disabled by NO_COLOR=true.")
+	keepOrderFlag        = flag.Bool("keepOrder", false, "Set to true to write the output of the tasks in task index order, instead of as they finish. Output of tasks which finish early is buffered.")
+	keepOrderBufferFlag  = flag.Int("keepOrderBuffer", DefaultKeepOrderBuffer, "Amount of tasks whose output is kept in memory while waiting for an earlier task when 'keepOrder' is set. Output beyond this spills to a temporary file.")
+	okExitFlag           = flag.String("okExit", "", "Exit codes of successful attempts, such as '0,2'. Defaults to only 0.")
+	okStdoutMatchFlag    = flag.String("okStdoutMatch", "", "Regex which the stdout of successful attempts must match.")
+	okStdoutNotMatchFlag = flag.String("okStdoutNotMatch", "", "Regex which the stdout of successful attempts must not match.")
+	okStderrEmptyFlag    = flag.Bool("okStderrEmpty", false, "Set to true to require the stderr of successful attempts to be empty.")
+	okMaxRuntimeFlag     = flag.Duration("okMaxRuntime", 0, "Maximum runtime of successful attempts, such as '2s'. Unlike 'timeout', the attempt runs to completion.")
+	okModeFlag           = flag.String("okMode", string(successAll), "How the success rules are combined. Options are: ['all', 'any']. The exit code rule is always included with 'all', and only if 'okExit' is set with 'any'.")
+	huntFlag             = flag.Bool("hunt", false, "Set to true to hunt for flakes. The run stops at the first failed attempt, which is saved to a reproducer bundle, and the observed failure rate is printed with a confidence interval.")
+	huntOutputFlag       = flag.Bool("huntOutput", false, "Set to true to also stop the hunt at the first successful attempt whose output differs from the first successful one.")
+	huntDirFlag          = flag.String("huntDir", "", "Directory of the reproducer bundle of the hunt. Defaults to 'repeater-hunt-<run id>'.")
+	groupOutputsFlag     = flag.Bool("groupOutputs", false, "Set to true to count the distinct outputs of the tasks, and show how each differs from the most common one in the statistics. Each result is marked with the hash of its output.")
+	dryRunFlag           = flag.Bool("dry-run", false, "Set to true to validate the configuration and print each task with its expanded command and environment, without running anything.")
+	rateFlag             = flag.String("rate", "", "Limit the rate at which tasks are started, independently of the amount of workers. Format is '<amount>/<unit>', such as '50/s', '300/m' or '1/500ms'.")
+)
+
+// stringsFlag is a flag which may be set multiple times
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, " ")
+}
+
+func (sf *stringsFlag) Set(s string) error {
+	*sf = append(*sf, s)
+	return nil
+}
 
 var (
-	amRunsFlag          = flag.Int("n", 1, "Amount of times you wish to repeat the command.")
-	verboseFlag         = flag.Bool("v", false, "Set to display the configured operation before running")
-	workersFlag         = flag.Int("w", 1, "Set the amout of workers to repeat the command with. Having more than 1 makes execution paralell. Expect performance diminishing returns when approaching CPU threads.")
-	colorFlag           = flag.Bool("nocolor", false, "Set to true to disable ansi-colored output")
-	progressFlag        = flag.String("progress", "STDOUT", "Options are: ['HIDDEN', 'FILE', 'STDOUT', 'BOTH']")
-	progressFormatFlag  = flag.String("progressFormat", DefaultProgressFormat, "Set the format for the output where 1st arg is the iteration and 2d arg is the amount of runs, 3d total, 4th start, 5th countdown (human-readable, e.g. '1d 2h 3m 4s'), 6th est completion time.")
-	outputFlag          = flag.String("output", "HIDDEN", "Options are: ['HIDDEN', 'FILE', 'STDOUT', 'BOTH']")
-	outputFormatFlag    = flag.String("outputFormat", outputFormatV1, "Options are: ['v1', 'v2']")
-	fileFlag            = flag.String("file", "", "Path to the file where the report will be saved, configure file conflicts automatically with 'fileMode'")
-	fileModeFlag        = flag.String("fileMode", "", "Configure how the report file should be treated. If a file exists, and this option isn't set, user will be queried. Options are: ['t'runcate, 'a'ppend] ")
-	statisticsFlag      = flag.Bool("statistics", true, "Set to true if you don't wish to see statistics of the repeated command.")
-	incrementFlag       = flag.Bool("increment", false, "Set to true and add an argument 'INC', to have 'INC' be replaced with the iteration. If increment == true && 'INC' is not set, repeater will panic.")
-	resultFlag          = flag.String("result", "", "Set this to some filename and get a json-formated output of all the performed tasks. This output is the basis of the statistics.")
-	retryOnFailFlag     = flag.Bool("retryOnFail", false, "Set to true to retry failed commands, effectively making repeate run until all commands are successful.")
-	outputOnSuccessFlag = flag.Bool("outputOnSuccess", true, "Set to false if you don't wish to see output on success")
+	matrixFlag    stringsFlag
+	envFlag       stringsFlag
+	normalizeFlag stringsFlag
 )
 
+func init() {
+	flag.Var(&matrixFlag, "matrix", "Parameter of a matrix on the format '<name>=<value>,<value>,...', such as 'size=1,10,100'. Set multiple times to add parameters. Each combination of the parameters is repeated '-n' times, and a parameter is referenced in the arguments as '{{<name>}}'. Statistics are calculated per combination.")
+	flag.Var(&normalizeFlag, "normalize", "Normalization rule of the outputs before they're compared by '-groupOutputs' or '-huntOutput'. Either one of the presets ['timestamp', 'uuid', 'duration', 'number'], or a regular expression whose matches are replaced by '<normalized>'. Set multiple times to add rules, which are applied in order.")
+	flag.BoolVar(dryRunFlag, "dryRun", false, "Alias of 'dry-run', in the camelCase of the other flags.")
+	flag.Var(&envFlag, "env", "Environment variable of the commands on the format 'KEY=VALUE'. Set multiple times to add variables. The value may contain the same placeholders as the arguments, such as 'INC' or '{{<name>}}'. See README for the variables which are always set.")
+}
+
 func main() {
 	flag.Parse()
 	ancli.Newline = true
@@ -43,13 +114,22 @@ func main() {
 
 	if len(args) < 1 {
 		printErr(fmt.Sprintf("error: %v", "you need to supply at least 1 argument\n"))
-		os.Exit(1)
+		os.Exit(exitConfigError)
+	}
+	progressFormat := *progressFormatFlag
+	if progressFormat == DefaultProgressFormat && (*durationFlag != 0 || *untilFlag != "") {
+		progressFormat = DefaultDurationProgressFormat
+	}
+	am := *amRunsFlag
+	if (*inputFlag != "" || *paramsFlag != "") && !isFlagSet("n") {
+		// Let the amount of lines, or rows, decide
+		am = 0
 	}
 	c, err := New(
-		*amRunsFlag,
+		am,
 		*workersFlag,
 		args, output.New(progressFlag),
-		*progressFormatFlag,
+		progressFormat,
 		output.New(outputFlag),
 		*outputFormatFlag,
 		*fileFlag,
@@ -58,6 +138,52 @@ func main() {
 		*resultFlag,
 		*retryOnFailFlag,
 		!*outputOnSuccessFlag,
+		runOptions{
+			rate:             *rateFlag,
+			duration:         *durationFlag,
+			until:            *untilFlag,
+			timeout:          *timeoutFlag,
+			maxAttempts:      *maxAttemptsFlag,
+			backoff:          *backoffFlag,
+			backoffBase:      *backoffBaseFlag,
+			backoffJitter:    *backoffJitterFlag,
+			halt:             *haltFlag,
+			input:            *inputFlag,
+			params:           *paramsFlag,
+			paramsCycle:      *paramsCycleFlag,
+			matrix:           matrixFlag,
+			template:         *templateFlag,
+			seed:             *seedFlag,
+			env:              envFlag,
+			shell:            *shellFlag,
+			shellCommand:     *shellCommandFlag,
+			dryRun:           *dryRunFlag,
+			resultFormat:     *resultFormatFlag,
+			histogramBuckets: *histogramFlag,
+			statisticsFormat: *statisticsFormatFlag,
+			lowMemory:        *lowMemoryFlag,
+			maxOutput:        *maxOutputFlag,
+			maxOutputKeep:    *maxOutputKeepFlag,
+			outputSpillDir:   *outputSpillDirFlag,
+			outputDir:        *outputDirFlag,
+			outputDirMeta:    *outputDirMetaFlag,
+			tag:              *tagFlag,
+			tagFormat:        *tagFormatFlag,
+			tagColor:         *tagColorFlag,
+			keepOrder:        *keepOrderFlag,
+			keepOrderBuffer:  *keepOrderBufferFlag,
+			okExit:           *okExitFlag,
+			okStdoutMatch:    *okStdoutMatchFlag,
+			okStdoutNotMatch: *okStdoutNotMatchFlag,
+			okStderrEmpty:    *okStderrEmptyFlag,
+			okMaxRuntime:     *okMaxRuntimeFlag,
+			okMode:           *okModeFlag,
+			hunt:             *huntFlag,
+			huntOutput:       *huntOutputFlag,
+			huntDir:          *huntDirFlag,
+			groupOutputs:     *groupOutputsFlag,
+			normalize:        normalizeFlag,
+		},
 	)
 
 	if *verboseFlag {
@@ -65,7 +191,15 @@ func main() {
 	}
 	if err != nil {
 		printErr(fmt.Sprintf("configuration error: %v\n", err))
-		os.Exit(1)
+		os.Exit(exitConfigError)
+	}
+
+	if *dryRunFlag {
+		if amFailed := c.dryRun(os.Stdout); amFailed > 0 {
+			printErr(fmt.Sprintf("%v tasks failed to expand\n", amFailed))
+			os.Exit(exitConfigError)
+		}
+		os.Exit(exitOK)
 	}
 
 	ctx, ctxCancel := context.WithCancel(context.Background())
@@ -85,14 +219,18 @@ func main() {
 	select {
 	case stats := <-isDone:
 		if *statisticsFlag {
-			fmt.Printf("%s\n", &stats)
+			fmt.Printf("%s\n", stats.format(c.statisticsFormat))
 		}
 
-		if c.resultFile != nil {
+		if c.resultFile != nil && c.resultFormat == resultFormatJSON {
 			slices.SortFunc(stats.Results, func(a, b Result) int {
 				return int(a.Runtime) - int(b.Runtime)
 			})
-			bytes, err := json.Marshal(stats.Results)
+			var toMarshal any = stats.Results
+			if c.params != nil && c.params.isMatrix() {
+				toMarshal = c.params.groupResults(stats.Results)
+			}
+			bytes, err := json.Marshal(toMarshal)
 			if err != nil {
 				printErr(fmt.Sprintf("failed to marshal results: %v", err))
 			} else {
@@ -100,8 +238,12 @@ func main() {
 				fmt.Fprintf(c.resultFile, "%v", string(bytes))
 			}
 		}
-		printOK("The repeat, has been done. Farewell.\n")
-		os.Exit(0)
+		if stats.haltReason != "" {
+			printErr(fmt.Sprintf("the repeat was halted: %v\n", stats.haltReason))
+		} else {
+			printOK("The repeat, has been done. Farewell.\n")
+		}
+		exit(stats.exitCode())
 	case <-signalChannel:
 		wasCancelled = true
 	}
@@ -112,10 +254,31 @@ func main() {
 			stats.cancelled = true
 		}
 		if *statisticsFlag {
-			fmt.Printf("%s\n", &stats)
+			fmt.Printf("%s\n", stats.format(c.statisticsFormat))
 		}
 		printOK("graceful shutdown complete")
+		exit(stats.exitCode())
 	case <-signalChannel:
 		printErr("aborting graceful shutdown")
+		exit(exitCancelled)
+	}
+}
+
+// isFlagSet returns true if the flag has been set on the command line
+func isFlagSet(name string) bool {
+	isSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			isSet = true
+		}
+	})
+	return isSet
+}
+
+// exit with the code, unless the user wishes to always exit with 0
+func exit(code int) {
+	if *exitZeroFlag {
+		code = exitOK
 	}
+	os.Exit(code)
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// parseMatrix from specs on the format '<name>=<value>,<value>,...' into a param table
+// where each row is one combination of the cartesian product, repeated for amPerCombination
+// consecutive tasks. Columns keep the order of the specs.
+func parseMatrix(specs []string, amPerCombination int) (*paramTable, error) {
+	if amPerCombination < 1 {
+		return nil, fmt.Errorf("amount of repetitions per combination must be at least 1, got: %v", amPerCombination)
+	}
+	pt := &paramTable{
+		rows:   [][]string{{}},
+		repeat: amPerCombination,
+	}
+	for _, spec := range specs {
+		name, valuesStr, found := strings.Cut(spec, "=")
+		if !found {
+			return nil, fmt.Errorf("matrix: %q, expected format '<name>=<value>,<value>,...'", spec)
+		}
+		values := strings.Split(valuesStr, ",")
+		for _, v := range values {
+			if v == "" {
+				return nil, fmt.Errorf("matrix: %q, has empty value", spec)
+			}
+		}
+		pt.columns = append(pt.columns, name)
+		rows := make([][]string, 0, len(pt.rows)*len(values))
+		for _, row := range pt.rows {
+			for _, v := range values {
+				rows = append(rows, append(append(make([]string, 0, len(row)+1), row...), v))
+			}
+		}
+		pt.rows = rows
+	}
+	if len(pt.columns) == 0 {
+		return nil, errors.New("matrix needs at least one parameter")
+	}
+	if err := pt.validate(); err != nil {
+		return nil, fmt.Errorf("matrix is invalid: %w", err)
+	}
+	return pt, nil
+}
+
+type combinationStats struct {
+	name string
+	statistics
+}
+
+// calcCombinationStats by calculating the statistics of each combination of the matrix, in
+// the order of the combinations
+func (c *configuredOper) calcCombinationStats() []combinationStats {
+	if c.lowMemory {
+		ret := make([]combinationStats, 0, len(c.combinationAggs))
+		for i, agg := range c.combinationAggs {
+			ret = append(ret, combinationStats{
+				name:       c.params.rowCombination(i),
+				statistics: agg.statistics(c.params.repeat),
+			})
+		}
+		return ret
+	}
+	groups := c.params.groupResults(c.results)
+	ret := make([]combinationStats, 0, len(groups))
+	for _, g := range groups {
+		ret = append(ret, combinationStats{
+			name:       g.Combination,
+			statistics: c.calcResultStats(g.Results, c.params.repeat),
+		})
+	}
+	return ret
+}
+
+// resultGroup is the results of one combination of a matrix run
+type resultGroup struct {
+	Combination string            `json:"combination"`
+	Params      map[string]string `json:"params"`
+	Results     []Result          `json:"results"`
+}
+
+// groupResults by combination, in the order of the combinations. Results keep their
+// relative order.
+func (pt *paramTable) groupResults(results []Result) []resultGroup {
+	groups := make([]resultGroup, len(pt.rows))
+	for i := range pt.rows {
+		groups[i] = resultGroup{
+			Combination: pt.rowCombination(i),
+			Params:      pt.values(i * pt.repeat),
+			Results:     make([]Result, 0),
+		}
+	}
+	for _, r := range results {
+		rowIdx := pt.rowIdx(r.Idx)
+		groups[rowIdx].Results = append(groups[rowIdx].Results, r)
+	}
+	return groups
+}
+
+func (s *statistics) combinationsString() string {
+	if len(s.combinations) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, cs := range s.combinations {
+		fmt.Fprintf(&sb, `
+
+== Statistics, %v ==
+Amount of repitions: %v, completed: %v, amount of failures: %v, amount of timeouts: %v, amount of cancelled: %v,
+The following is calculated on successful attempts:
+  Total routine work time: %v,
+  Average time per task: %v, Std deviation: %v
+  Max time, index: %v, time: %v
+  Min time, index: %v, time: %v
+  Percentiles%v, %v`,
+			cs.name,
+			cs.am, cs.amDone, cs.amFails, cs.amTimeouts, cs.amCancelled,
+			cs.total,
+			cs.average, cs.stdDev,
+			cs.max.Idx, cs.max.Runtime,
+			cs.min.Idx, cs.min.Runtime,
+			estimatedString(cs.estimated), percentilesString(cs.percentiles))
+	}
+	sb.WriteString("\n\n== Comparison ==\n")
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Combination\tCompleted\tFailures\tAverage\tStd deviation\tMin\tMax\tP50\tP99")
+	for _, cs := range s.combinations {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			cs.name, cs.amDone, cs.amFails+cs.amTimeouts,
+			cs.average, cs.stdDev, cs.min.Runtime, cs.max.Runtime,
+			percentileOf(cs.percentiles, 50), percentileOf(cs.percentiles, 99))
+	}
+	w.Flush()
+	return strings.TrimSuffix(sb.String(), "\n")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_parseMatrix(t *testing.T) {
+	t.Run("it should expand the cartesian product in spec order", func(t *testing.T) {
+		got, err := parseMatrix([]string{"size=1,10", "threads=1,4,8"}, 2)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if !slices.Equal(got.columns, []string{"size", "threads"}) {
+			t.Fatalf("unexpected columns: %q", got.columns)
+		}
+		if len(got.rows) != 6 {
+			t.Fatalf("expected 6 combinations, got: %v", len(got.rows))
+		}
+		wantCombinations := []string{
+			"size=1,threads=1", "size=1,threads=4", "size=1,threads=8",
+			"size=10,threads=1", "size=10,threads=4", "size=10,threads=8",
+		}
+		for i, want := range wantCombinations {
+			if got := got.rowCombination(i); got != want {
+				t.Fatalf("for row: %v, expected: %v, got: %v", i, want, got)
+			}
+		}
+	})
+
+	t.Run("it should repeat each combination for consecutive tasks", func(t *testing.T) {
+		pt, err := parseMatrix([]string{"size=1,10"}, 3)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		for taskIdx, want := range []string{"1", "1", "1", "10", "10", "10"} {
+			if got := pt.values(taskIdx)["size"]; got != want {
+				t.Fatalf("for task: %v, expected: %v, got: %v", taskIdx, want, got)
+			}
+		}
+	})
+
+	t.Run("it should return error on bad specs", func(t *testing.T) {
+		for _, specs := range [][]string{{"size"}, {"size=1,,2"}, {"=1,2"}, {"size=1", "size=2"}, {}} {
+			if _, err := parseMatrix(specs, 1); err == nil {
+				t.Fatalf("for: %q, expected error, got nil", specs)
+			}
+		}
+	})
+}
+
+func Test_configuredOper_New_matrix(t *testing.T) {
+	c, err := New(3, 1, []string{"echo", "{{size}}"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false,
+		runOptions{matrix: []string{"size=1,10", "threads=1,4"}})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.am != 12 {
+		t.Fatalf("expected 3 repetitions of 4 combinations, got: %v", c.am)
+	}
+}
+
+func Test_configuredOper_calcStats_matrix(t *testing.T) {
+	pt, err := parseMatrix([]string{"size=1,10"}, 2)
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	c := configuredOper{
+		am:     4,
+		params: pt,
+		results: []Result{
+			{Idx: 0, Runtime: 1 * time.Second},
+			{Idx: 2, Runtime: 10 * time.Second},
+			{Idx: 1, Runtime: 3 * time.Second},
+			{Idx: 3, Runtime: 30 * time.Second, IsError: true},
+		},
+	}
+	stats := c.calcStats()
+	if len(stats.combinations) != 2 {
+		t.Fatalf("expected 2 combinations, got: %v", len(stats.combinations))
+	}
+	first := stats.combinations[0]
+	if first.name != "size=1" || first.amDone != 2 || first.average != 2*time.Second {
+		t.Fatalf("unexpected statistics of first combination: %+v", first)
+	}
+	second := stats.combinations[1]
+	if second.name != "size=10" || second.amFails != 1 || second.max.Runtime != 10*time.Second {
+		t.Fatalf("unexpected statistics of second combination: %+v", second)
+	}
+	got := stats.String()
+	for _, want := range []string{"== Statistics, size=1 ==", "== Statistics, size=10 ==", "== Comparison =="} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected statistics to contain: %q, got: %s", want, got)
+		}
+	}
+
+	groups := pt.groupResults(c.results)
+	if len(groups[0].Results) != 2 || len(groups[1].Results) != 2 {
+		t.Fatalf("expected results to be grouped by combination, got: %+v", groups)
+	}
+	if groups[1].Params["size"] != "10" {
+		t.Fatalf("expected group to hold its params, got: %v", groups[1].Params)
+	}
+}
+
+func Test_configuredOper_run_matrix(t *testing.T) {
+	pt, err := parseMatrix([]string{"word=a,b"}, 2)
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	c := configuredOper{
+		am:            4,
+		args:          []string{"printf", "%s", "{{word}}"},
+		params:        pt,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	for _, cs := range stats.combinations {
+		if cs.amDone != 2 {
+			t.Fatalf("expected 2 tasks for combination: %v, got: %v", cs.name, cs.amDone)
+		}
+	}
+	for _, r := range stats.Results {
+		if r.Output != r.Params["word"] {
+			t.Fatalf("expected output to match params, got output: %q, params: %v", r.Output, r.Params)
+		}
+	}
+}
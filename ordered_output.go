@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sync"
+)
+
+// DefaultKeepOrderBuffer is the amount of tasks whose output may be kept in memory while
+// waiting for an earlier task, before it spills to disk
+const DefaultKeepOrderBuffer = 1024
+
+// orderedChunk of output of one attempt, either in memory or spilled to disk
+type orderedChunk struct {
+	text    string
+	spilled bool
+	offset  int64
+	length  int
+}
+
+type orderedTask struct {
+	chunks []orderedChunk
+	done   bool
+}
+
+// orderedOutput releases the output of tasks strictly in task index order. The output
+// of tasks which finish ahead of an earlier task is buffered, in memory up to maxBuffered
+// tasks and on disk beyond that. Tasks which are skipped by the workers must be marked
+// as such, so that the following tasks aren't held back.
+type orderedOutput struct {
+	mu          sync.Mutex
+	maxBuffered int
+	write       func(string)
+	next        int
+	pending     map[int]*orderedTask
+	// amInMemory is the amount of pending tasks with output in memory
+	amInMemory  int
+	spill       *os.File
+	spillOffset int64
+}
+
+func newOrderedOutput(maxBuffered int, write func(string)) *orderedOutput {
+	return &orderedOutput{
+		maxBuffered: maxBuffered,
+		write:       write,
+		pending:     make(map[int]*orderedTask),
+	}
+}
+
+// add the output of an attempt of the task. Once the task is done, it's released along
+// with every following task which is done, in order.
+func (oo *orderedOutput) add(taskIdx int, text string, done bool) {
+	oo.mu.Lock()
+	defer oo.mu.Unlock()
+	if taskIdx < oo.next {
+		// The task was already released by a flush, so there is nothing to wait for
+		oo.write(text)
+		return
+	}
+	task, exists := oo.pending[taskIdx]
+	if !exists {
+		task = &orderedTask{}
+		oo.pending[taskIdx] = task
+	}
+	if text != "" {
+		task.chunks = append(task.chunks, oo.buffer(taskIdx, task, text))
+	}
+	task.done = task.done || done
+	for {
+		task, exists := oo.pending[oo.next]
+		if !exists || !task.done {
+			return
+		}
+		oo.release(oo.next, task)
+		oo.next++
+	}
+}
+
+// skip the task, which will never run, so that it doesn't hold back the following tasks
+func (oo *orderedOutput) skip(taskIdx int) {
+	oo.add(taskIdx, "", true)
+}
+
+// buffer the text of the task, in memory unless too many tasks are buffered already.
+// The task which is up next is always kept in memory.
+func (oo *orderedOutput) buffer(taskIdx int, task *orderedTask, text string) orderedChunk {
+	inMemory := slices.ContainsFunc(task.chunks, func(c orderedChunk) bool { return !c.spilled })
+	if inMemory || taskIdx == oo.next || oo.amInMemory < oo.maxBuffered {
+		if !inMemory {
+			oo.amInMemory++
+		}
+		return orderedChunk{text: text}
+	}
+	chunk, err := oo.spillText(text)
+	if err != nil {
+		printErr(fmt.Sprintf("failed to spill output of task: %v to disk, keeping it in memory, err: %v", taskIdx, err))
+		oo.amInMemory++
+		return orderedChunk{text: text}
+	}
+	return chunk
+}
+
+func (oo *orderedOutput) spillText(text string) (orderedChunk, error) {
+	if oo.spill == nil {
+		f, err := os.CreateTemp("", "repeater-ordered-output-")
+		if err != nil {
+			return orderedChunk{}, err
+		}
+		oo.spill = f
+	}
+	n, err := oo.spill.WriteAt([]byte(text), oo.spillOffset)
+	if err != nil {
+		return orderedChunk{}, err
+	}
+	chunk := orderedChunk{spilled: true, offset: oo.spillOffset, length: n}
+	oo.spillOffset += int64(n)
+	return chunk, nil
+}
+
+// release the output of the task
+func (oo *orderedOutput) release(taskIdx int, task *orderedTask) {
+	inMemory := false
+	for _, chunk := range task.chunks {
+		if !chunk.spilled {
+			inMemory = true
+			oo.write(chunk.text)
+			continue
+		}
+		b := make([]byte, chunk.length)
+		if _, err := oo.spill.ReadAt(b, chunk.offset); err != nil && err != io.EOF {
+			printErr(fmt.Sprintf("failed to read spilled output of task: %v, err: %v", taskIdx, err))
+			continue
+		}
+		oo.write(string(b))
+	}
+	if inMemory {
+		oo.amInMemory--
+	}
+	delete(oo.pending, taskIdx)
+}
+
+// flush the output of every pending task in order, including tasks which never finished,
+// such as tasks whose retry was cancelled, and remove the spill file
+func (oo *orderedOutput) flush() {
+	oo.mu.Lock()
+	defer oo.mu.Unlock()
+	idxs := make([]int, 0, len(oo.pending))
+	for taskIdx := range oo.pending {
+		idxs = append(idxs, taskIdx)
+	}
+	slices.Sort(idxs)
+	for _, taskIdx := range idxs {
+		oo.release(taskIdx, oo.pending[taskIdx])
+		oo.next = taskIdx + 1
+	}
+	if oo.spill != nil {
+		oo.spill.Close()
+		os.Remove(oo.spill.Name())
+		oo.spill = nil
+		oo.spillOffset = 0
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_orderedOutput(t *testing.T) {
+	t.Run("releases in order", func(t *testing.T) {
+		var got []string
+		oo := newOrderedOutput(10, func(s string) { got = append(got, s) })
+		oo.add(2, "c", true)
+		oo.add(1, "b", true)
+		if len(got) != 0 {
+			t.Fatalf("expected output to wait for task 0, got: %v", got)
+		}
+		oo.add(0, "a", true)
+		if strings.Join(got, "") != "abc" {
+			t.Fatalf("expected: abc, got: %v", got)
+		}
+	})
+
+	t.Run("attempts are held back until the task is done", func(t *testing.T) {
+		var got []string
+		oo := newOrderedOutput(10, func(s string) { got = append(got, s) })
+		oo.add(1, "b", true)
+		oo.add(0, "a1", false)
+		if len(got) != 0 {
+			t.Fatalf("expected output to wait for the last attempt, got: %v", got)
+		}
+		oo.add(0, "a2", true)
+		if strings.Join(got, ",") != "a1,a2,b" {
+			t.Fatalf("expected: a1,a2,b, got: %v", got)
+		}
+	})
+
+	t.Run("skipped tasks don't hold back", func(t *testing.T) {
+		var got []string
+		oo := newOrderedOutput(10, func(s string) { got = append(got, s) })
+		oo.add(0, "a", true)
+		oo.add(2, "c", true)
+		oo.skip(1)
+		if strings.Join(got, "") != "ac" {
+			t.Fatalf("expected: ac, got: %v", got)
+		}
+	})
+
+	t.Run("spills beyond the buffer", func(t *testing.T) {
+		var got []string
+		oo := newOrderedOutput(2, func(s string) { got = append(got, s) })
+		for i := 10; i > 0; i-- {
+			oo.add(i, fmt.Sprint(i), true)
+		}
+		if oo.spill == nil {
+			t.Fatal("expected output to spill to disk")
+		}
+		if oo.amInMemory != 2 {
+			t.Fatalf("expected: 2 tasks in memory, got: %v", oo.amInMemory)
+		}
+		spillPath := oo.spill.Name()
+		oo.add(0, "0", true)
+		if strings.Join(got, ",") != "0,1,2,3,4,5,6,7,8,9,10" {
+			t.Fatalf("expected output in order, got: %v", got)
+		}
+		oo.flush()
+		if _, err := os.Stat(spillPath); !os.IsNotExist(err) {
+			t.Fatalf("expected spill file to be removed, got: %v", err)
+		}
+	})
+
+	t.Run("flush releases unfinished tasks in order", func(t *testing.T) {
+		var got []string
+		oo := newOrderedOutput(10, func(s string) { got = append(got, s) })
+		oo.add(3, "d", true)
+		oo.add(1, "b", false)
+		oo.flush()
+		if strings.Join(got, "") != "bd" {
+			t.Fatalf("expected: bd, got: %v", got)
+		}
+		// Late output is written as is
+		oo.add(2, "c", true)
+		if strings.Join(got, "") != "bdc" {
+			t.Fatalf("expected: bdc, got: %v", got)
+		}
+	})
+}
+
+func Test_configuredOper_run_keepOrder(t *testing.T) {
+	outputPath := t.TempDir() + "/output"
+	f, err := os.Create(outputPath)
+	if err != nil {
+		t.Fatalf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+	// Earlier tasks sleep longer, so that they finish last
+	c := configuredOper{
+		am:              8,
+		workers:         4,
+		args:            []string{"sh", "-c", `sleep 0.0$((8 - REPEATER_TASK_IDX)); echo $REPEATER_TASK_IDX`},
+		output:          output.FILE,
+		outputFile:      f,
+		keepOrder:       true,
+		keepOrderBuffer: 2,
+		amIdleWorkers:   4,
+		workPlanMu:      &sync.Mutex{},
+		workerWg:        &sync.WaitGroup{},
+	}
+	c.workerWg.Add(4)
+	c.run(context.Background())
+	b, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	if want := "0\n1\n2\n3\n4\n5\n6\n7\n"; string(b) != want {
+		t.Fatalf("expected: %q, got: %q", want, b)
+	}
+}
+
+func Test_configuredOper_New_keepOrder(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{keepOrder: true, keepOrderBuffer: -1})
+	if err == nil {
+		t.Fatal("expected error for negative keepOrderBuffer, got nil")
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{keepOrder: true})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.keepOrderBuffer != DefaultKeepOrderBuffer {
+		t.Fatalf("expected default buffer: %v, got: %v", DefaultKeepOrderBuffer, c.keepOrderBuffer)
+	}
+}
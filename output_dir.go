@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Names of the files written to the output directory of each task
+const (
+	taskStdoutFile = "stdout"
+	taskStderrFile = "stderr"
+	taskMetaFile   = "meta.json"
+)
+
+// parseOutputDirTemplate of the output directory of each task, such as './runs/{{.Idx}}'.
+// The directory may contain the same placeholders as the arguments.
+func parseOutputDirTemplate(dir string, params *paramTable) (*template.Template, error) {
+	tmpls, err := parseArgTemplates([]string{dir}, params, false)
+	if err != nil {
+		return nil, fmt.Errorf("outputDir: %w", err)
+	}
+	return tmpls[0], nil
+}
+
+// taskOutputDir expands the output directory of the task
+func (c *configuredOper) taskOutputDir(taskIdx, workerID, attempt int) (string, error) {
+	values, err := executeTemplates([]*template.Template{c.outputDirTemplate}, c.templateData(taskIdx, workerID, attempt))
+	if err != nil {
+		return "", fmt.Errorf("failed to execute outputDir template: %w", err)
+	}
+	values = c.replaceIncrement(values, taskIdx)
+	values = c.replaceLinePlaceholder(values, taskIdx, nil)
+	if c.params != nil {
+		values = c.params.replace(values, taskIdx, nil)
+	}
+	if strings.TrimSpace(values[0]) == "" {
+		return "", errors.New("outputDir of task expanded to nothing")
+	}
+	return values[0], nil
+}
+
+// attemptFileName of the file in the output directory. The first attempt uses the name
+// as is, retries are suffixed by the attempt, such as 'stdout.2' or 'meta.2.json', so
+// that they don't overwrite each other.
+func attemptFileName(name string, attempt int) string {
+	if attempt <= 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + strconv.Itoa(attempt) + ext
+}
+
+// taskOutputFiles which the output of one task attempt is written to, as it's produced
+type taskOutputFiles struct {
+	dir     string
+	attempt int
+	stdout  *os.File
+	stderr  *os.File
+}
+
+// openTaskOutputFiles in the directory, which is created if it doesn't exist
+func openTaskOutputFiles(dir string, attempt int) (*taskOutputFiles, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output dir: %w", err)
+	}
+	stdout, err := os.Create(filepath.Join(dir, attemptFileName(taskStdoutFile, attempt)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout file: %w", err)
+	}
+	stderr, err := os.Create(filepath.Join(dir, attemptFileName(taskStderrFile, attempt)))
+	if err != nil {
+		stdout.Close()
+		return nil, fmt.Errorf("failed to create stderr file: %w", err)
+	}
+	return &taskOutputFiles{dir: dir, attempt: attempt, stdout: stdout, stderr: stderr}, nil
+}
+
+// finish by closing the files and, if meta is set, writing the result without its
+// output as metadata next to them
+func (tf *taskOutputFiles) finish(res *Result, meta bool) {
+	tf.stdout.Close()
+	tf.stderr.Close()
+	res.OutputDir = tf.dir
+	if !meta {
+		return
+	}
+	b, err := json.MarshalIndent(withoutOutput(*res), "", "  ")
+	if err != nil {
+		printErr(fmt.Sprintf("failed to marshal metadata of task: %v, err: %v", res.Idx, err))
+		return
+	}
+	metaPath := filepath.Join(tf.dir, attemptFileName(taskMetaFile, tf.attempt))
+	if err := os.WriteFile(metaPath, append(b, '\n'), 0o644); err != nil {
+		printErr(fmt.Sprintf("failed to write metadata of task: %v, to: %v, err: %v", res.Idx, metaPath, err))
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_attemptFileName(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		attempt int
+		want    string
+	}{
+		{taskStdoutFile, 1, "stdout"},
+		{taskStdoutFile, 2, "stdout.2"},
+		{taskMetaFile, 1, "meta.json"},
+		{taskMetaFile, 3, "meta.3.json"},
+	} {
+		if got := attemptFileName(tc.name, tc.attempt); got != tc.want {
+			t.Fatalf("expected: %q, got: %q", tc.want, got)
+		}
+	}
+}
+
+func Test_configuredOper_run_outputDir(t *testing.T) {
+	runsDir := t.TempDir()
+	tmpl, err := parseOutputDirTemplate(runsDir+"/{{pad 2 .Idx}}", nil)
+	if err != nil {
+		t.Fatalf("failed to parse outputDir: %v", err)
+	}
+	// Odd tasks fail on their first attempt
+	c := configuredOper{
+		am:                3,
+		args:              []string{"sh", "-c", `echo "out $REPEATER_TASK_IDX"; echo "err $REPEATER_ATTEMPT" >&2; [ $((REPEATER_TASK_IDX % 2)) -eq 0 ] || [ $REPEATER_ATTEMPT -eq 2 ]`},
+		outputDirTemplate: tmpl,
+		outputDirMeta:     true,
+		retry:             retryPolicy{maxAttempts: 2, backoff: backoffConst, base: time.Millisecond},
+		amIdleWorkers:     1,
+		workPlanMu:        &sync.Mutex{},
+		workerWg:          &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if len(stats.Results) != 4 {
+		t.Fatalf("expected 4 attempts, got: %v", len(stats.Results))
+	}
+
+	readFile := func(t *testing.T, path string) string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		return string(b)
+	}
+	for taskIdx := 0; taskIdx < 3; taskIdx++ {
+		dir := filepath.Join(runsDir, fmt.Sprintf("%02d", taskIdx))
+		if got, want := readFile(t, filepath.Join(dir, "stdout")), fmt.Sprintf("out %v\n", taskIdx); got != want {
+			t.Fatalf("expected stdout: %q, got: %q", want, got)
+		}
+		if got := readFile(t, filepath.Join(dir, "stderr")); got != "err 1\n" {
+			t.Fatalf("expected stderr of the first attempt, got: %q", got)
+		}
+		var meta Result
+		if err := json.Unmarshal([]byte(readFile(t, filepath.Join(dir, "meta.json"))), &meta); err != nil {
+			t.Fatalf("failed to unmarshal meta: %v", err)
+		}
+		if meta.Idx != taskIdx || meta.OutputDir != dir || meta.Output != "" {
+			t.Fatalf("expected metadata of task: %v without output, got: %+v", taskIdx, meta)
+		}
+		if meta.IsError != (taskIdx%2 == 1) {
+			t.Fatalf("expected isError of the first attempt to be: %v", taskIdx%2 == 1)
+		}
+	}
+	// Retries don't overwrite the first attempt
+	if got := readFile(t, filepath.Join(runsDir, "01", "stderr.2")); got != "err 2\n" {
+		t.Fatalf("expected stderr of the retry, got: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(runsDir, "01", "meta.2.json")); err != nil {
+		t.Fatalf("expected metadata of the retry, got: %v", err)
+	}
+}
+
+func Test_configuredOper_New_outputDir(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{outputDirMeta: true})
+	if err == nil {
+		t.Fatal("expected error as outputDirMeta requires outputDir, got nil")
+	}
+	_, err = New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{outputDir: "runs/{{.Missing}}"})
+	if err == nil || !strings.Contains(err.Error(), "outputDir") {
+		t.Fatalf("expected error for unknown field of outputDir, got: %v", err)
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{outputDir: t.TempDir() + "/{{.Idx}}"})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.outputDirTemplate == nil {
+		t.Fatal("expected outputDir template to be set")
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxOutputGroups which are kept with a representative output. Outputs which differ
+	// from every kept group beyond this are only counted, so that commands with unique
+	// output don't grow the memory.
+	maxOutputGroups = 100
+	// maxOutputDiffLines of the diff between a group and the most common output
+	maxOutputDiffLines = 50
+	// outputDiffContext is the amount of unchanged lines shown around each change
+	outputDiffContext = 2
+	// maxOutputDiffCells limits the size of the table of the line diff. Larger outputs
+	// are diffed by their common start and end only.
+	maxOutputDiffCells = 4_000_000
+)
+
+// normalizePresets are the named normalization rules, and the text which replaces their
+// matches
+var normalizePresets = map[string]struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	"timestamp": {
+		re:          regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?|\d{2}:\d{2}:\d{2}(\.\d+)?`),
+		replacement: "<timestamp>",
+	},
+	"uuid": {
+		re:          regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`),
+		replacement: "<uuid>",
+	},
+	"duration": {
+		re:          regexp.MustCompile(`\b\d+(\.\d+)?(ns|us|µs|ms|s|m|h)\b`),
+		replacement: "<duration>",
+	},
+	"number": {
+		re:          regexp.MustCompile(`\d+(\.\d+)?`),
+		replacement: "<number>",
+	},
+}
+
+// normalizeRule replaces every match of re by replacement
+type normalizeRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// outputNormalizer rewrites the output of an attempt before it's compared, so that
+// outputs which only differ by such as timestamps are considered equal
+type outputNormalizer []normalizeRule
+
+// parseNormalizeRules of the presets ['timestamp', 'uuid', 'duration', 'number'], or
+// regular expressions whose matches are replaced by '<normalized>'. Rules are applied in
+// order.
+func parseNormalizeRules(rules []string) (outputNormalizer, error) {
+	var n outputNormalizer
+	for _, rule := range rules {
+		if preset, exists := normalizePresets[rule]; exists {
+			n = append(n, normalizeRule{re: preset.re, replacement: preset.replacement})
+			continue
+		}
+		re, err := regexp.Compile(rule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile normalize rule: %q, expected one of ['timestamp', 'uuid', 'duration', 'number'] or a regular expression: %w", rule, err)
+		}
+		n = append(n, normalizeRule{re: re, replacement: "<normalized>"})
+	}
+	return n, nil
+}
+
+func (n outputNormalizer) normalize(output string) string {
+	for _, rule := range n {
+		output = rule.re.ReplaceAllLiteralString(output, rule.replacement)
+	}
+	return output
+}
+
+func (n outputNormalizer) String() string {
+	rules := make([]string, 0, len(n))
+	for _, rule := range n {
+		rules = append(rules, rule.re.String())
+	}
+	return fmt.Sprintf("%q", rules)
+}
+
+// outputHash of the normalized output, short enough to be read but long enough to not
+// collide in practice
+func outputHash(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// outputGroup of attempts whose normalized output is equal
+type outputGroup struct {
+	Hash         string `json:"hash"`
+	Count        int    `json:"count"`
+	FirstTaskIdx int    `json:"firstTaskIdx"`
+	// Output of the first attempt of the group, as it was written by the command
+	Output string `json:"output"`
+	// Diff of the normalized output versus the most common output, empty for the most
+	// common output itself
+	Diff string `json:"diff,omitempty"`
+}
+
+// outputGroupStats of the attempts which ran to completion
+type outputGroupStats struct {
+	Attempts int `json:"attempts"`
+	// Distinct is the amount of groups of distinct normalized outputs
+	Distinct      int  `json:"distinct"`
+	Deterministic bool `json:"deterministic"`
+	// Ungrouped is the amount of attempts whose output differed from every group, once
+	// the amount of groups reached its limit. These may be distinct from each other too.
+	Ungrouped int           `json:"ungrouped,omitempty"`
+	Groups    []outputGroup `json:"groups"`
+}
+
+// outputGrouper counts the distinct outputs of the attempts which ran to completion. It
+// keeps one representative output per group, in place of every result, so that it may be
+// used with lowMemory.
+type outputGrouper struct {
+	normalizer outputNormalizer
+	amAttempts int
+	groups     map[string]*outputGroup
+	// amUngrouped attempts, beyond maxOutputGroups
+	amUngrouped int
+}
+
+func newOutputGrouper(normalizer outputNormalizer) *outputGrouper {
+	return &outputGrouper{
+		normalizer: normalizer,
+		groups:     make(map[string]*outputGroup),
+	}
+}
+
+// add the output of the attempt to its group, and set its output hash. Attempts which
+// were cancelled or timed out are cut short, so their output isn't grouped.
+func (og *outputGrouper) add(res *Result) {
+	if og == nil || res.IsCancelled || res.IsTimeout {
+		return
+	}
+	res.OutputHash = outputHash(og.normalizer.normalize(res.Output))
+	og.amAttempts++
+	if g, exists := og.groups[res.OutputHash]; exists {
+		g.Count++
+		return
+	}
+	if len(og.groups) >= maxOutputGroups {
+		og.amUngrouped++
+		return
+	}
+	og.groups[res.OutputHash] = &outputGroup{
+		Hash:         res.OutputHash,
+		Count:        1,
+		FirstTaskIdx: res.Idx,
+		Output:       res.Output,
+	}
+}
+
+// stats of the groups, sorted from most to least common, each with a diff versus the
+// most common output. Nil if no attempts were grouped.
+func (og *outputGrouper) stats() *outputGroupStats {
+	if og == nil || og.amAttempts == 0 {
+		return nil
+	}
+	groups := make([]outputGroup, 0, len(og.groups))
+	for _, g := range og.groups {
+		groups = append(groups, *g)
+	}
+	slices.SortFunc(groups, func(a, b outputGroup) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return a.FirstTaskIdx - b.FirstTaskIdx
+	})
+	common := og.normalizer.normalize(groups[0].Output)
+	for i := 1; i < len(groups); i++ {
+		groups[i].Diff = lineDiff(common, og.normalizer.normalize(groups[i].Output))
+	}
+	return &outputGroupStats{
+		Attempts:      og.amAttempts,
+		Distinct:      len(groups),
+		Deterministic: len(groups) == 1 && og.amUngrouped == 0,
+		Ungrouped:     og.amUngrouped,
+		Groups:        groups,
+	}
+}
+
+// lineDiff of b versus a, with removed lines prefixed by '-', added lines by '+' and
+// the unchanged lines around each change by ' '
+func lineDiff(a, b string) string {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+	// Keep the common start and end out of the table, as variants tend to differ little
+	prefix := 0
+	for prefix < len(aLines) && prefix < len(bLines) && aLines[prefix] == bLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(aLines)-prefix && suffix < len(bLines)-prefix &&
+		aLines[len(aLines)-1-suffix] == bLines[len(bLines)-1-suffix] {
+		suffix++
+	}
+	ops := make([]diffOp, 0, len(aLines)+len(bLines))
+	for _, l := range aLines[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', line: l})
+	}
+	ops = append(ops, diffLines(aLines[prefix:len(aLines)-suffix], bLines[prefix:len(bLines)-suffix])...)
+	for _, l := range aLines[len(aLines)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', line: l})
+	}
+	return formatDiff(ops)
+}
+
+// splitLines of the text, keeping their line breaks
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+type diffOp struct {
+	// kind is one of ' ', '-' or '+'
+	kind byte
+	line string
+}
+
+// diffLines by their longest common subsequence. If the table would be too large, every
+// line of a is removed and every line of b added.
+func diffLines(a, b []string) []diffOp {
+	var ops []diffOp
+	if len(a)*len(b) > maxOutputDiffCells {
+		for _, l := range a {
+			ops = append(ops, diffOp{kind: '-', line: l})
+		}
+		for _, l := range b {
+			ops = append(ops, diffOp{kind: '+', line: l})
+		}
+		return ops
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{kind: ' ', line: a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', line: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// formatDiff of the changes, with outputDiffContext unchanged lines around each change,
+// and at most maxOutputDiffLines lines
+func formatDiff(ops []diffOp) string {
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := max(i-outputDiffContext, 0); j <= min(i+outputDiffContext, len(ops)-1); j++ {
+			show[j] = true
+		}
+	}
+	var sb strings.Builder
+	amLines := 0
+	skipped := false
+	for i, op := range ops {
+		if !show[i] {
+			skipped = true
+			continue
+		}
+		if amLines == maxOutputDiffLines {
+			amChanges := 0
+			for _, rest := range ops[i:] {
+				if rest.kind != ' ' {
+					amChanges++
+				}
+			}
+			fmt.Fprintf(&sb, "... %v more changed lines\n", amChanges)
+			break
+		}
+		if skipped && amLines > 0 {
+			sb.WriteString("...\n")
+		}
+		skipped = false
+		sb.WriteByte(op.kind)
+		sb.WriteString(strings.TrimSuffix(op.line, "\n"))
+		sb.WriteByte('\n')
+		amLines++
+	}
+	return sb.String()
+}
+
+func outputGroupsString(ogs *outputGroupStats) string {
+	if ogs == nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\n== Output groups ==\n")
+	fmt.Fprintf(&sb, "Distinct outputs: %v, of %v attempts, deterministic: %v", ogs.Distinct, ogs.Attempts, ogs.Deterministic)
+	if ogs.Ungrouped > 0 {
+		fmt.Fprintf(&sb, ", attempts ungrouped beyond %v groups: %v", maxOutputGroups, ogs.Ungrouped)
+	}
+	for i, g := range ogs.Groups {
+		fmt.Fprintf(&sb, "\n  #%v hash: %v, count: %v (%.1f%%), first task: %v",
+			i+1, g.Hash, g.Count, float64(g.Count)/float64(ogs.Attempts)*100, g.FirstTaskIdx)
+		if g.Diff != "" {
+			sb.WriteString("\n    " + strings.ReplaceAll(strings.TrimSuffix(g.Diff, "\n"), "\n", "\n    "))
+		}
+	}
+	return sb.String()
+}
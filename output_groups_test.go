@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_parseNormalizeRules(t *testing.T) {
+	n, err := parseNormalizeRules([]string{"timestamp", "uuid", `took \d+`})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	got := n.normalize("2024-01-02T03:04:05Z id: 0b7c2a6e-5a1f-4c4e-9d0b-3f4f2a1b9c8d took 12ms\n")
+	want := "<timestamp> id: <uuid> <normalized>ms\n"
+	if got != want {
+		t.Fatalf("expected: %q, got: %q", want, got)
+	}
+	if _, err := parseNormalizeRules([]string{"("}); err == nil {
+		t.Fatal("expected error for bad regular expression")
+	}
+}
+
+func Test_lineDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "changed line", a: "a\nb\nc\n", b: "a\nx\nc\n", want: " a\n-b\n+x\n c\n"},
+		{name: "added line", a: "a\nb\n", b: "a\nb\nc\n", want: " a\n b\n+c\n"},
+		{name: "removed line", a: "a\nb\nc\n", b: "a\nc\n", want: " a\n-b\n c\n"},
+		{
+			name: "only context around changes",
+			a:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:    "x\n2\n3\n4\n5\n6\n7\n8\ny\n",
+			want: "-1\n+x\n 2\n 3\n...\n 7\n 8\n-9\n+y\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := lineDiff(tc.a, tc.b); got != tc.want {
+				t.Fatalf("expected:\n%s\ngot:\n%s", tc.want, got)
+			}
+		})
+	}
+
+	t.Run("it should limit the amount of lines", func(t *testing.T) {
+		var a, b strings.Builder
+		for i := 0; i < 2*maxOutputDiffLines; i++ {
+			a.WriteString("a\n")
+			b.WriteString("b\n")
+		}
+		got := lineDiff(a.String(), b.String())
+		if lines := strings.Count(got, "\n"); lines != maxOutputDiffLines+1 {
+			t.Fatalf("expected: %v lines, got: %v", maxOutputDiffLines+1, lines)
+		}
+		if !strings.Contains(got, "more changed lines") {
+			t.Fatalf("expected the diff to be cut, got: %s", got)
+		}
+	})
+}
+
+func Test_outputGrouper(t *testing.T) {
+	normalizer, _ := parseNormalizeRules([]string{"number"})
+	og := newOutputGrouper(normalizer)
+	results := []Result{
+		{Idx: 0, Output: "took 1ms\nok\n"},
+		{Idx: 1, Output: "took 2ms\nok\n"},
+		{Idx: 2, Output: "took 3ms\nFAIL\n"},
+		{Idx: 3, Output: "partial", IsCancelled: true},
+		{Idx: 4, Output: "took 4ms\nok\n"},
+	}
+	for i := range results {
+		og.add(&results[i])
+	}
+	if results[0].OutputHash == "" || results[0].OutputHash != results[1].OutputHash || results[0].OutputHash == results[2].OutputHash {
+		t.Fatalf("expected outputs to be hashed by their normalized output, got: %q, %q, %q",
+			results[0].OutputHash, results[1].OutputHash, results[2].OutputHash)
+	}
+	if results[3].OutputHash != "" {
+		t.Fatal("expected cancelled attempt to not be grouped")
+	}
+
+	ogs := og.stats()
+	if ogs.Attempts != 4 || ogs.Distinct != 2 || ogs.Deterministic {
+		t.Fatalf("unexpected stats: %+v", ogs)
+	}
+	if ogs.Groups[0].Count != 3 || ogs.Groups[0].Diff != "" {
+		t.Fatalf("expected the most common group first, got: %+v", ogs.Groups[0])
+	}
+	want := " took <number>ms\n-ok\n+FAIL\n"
+	if ogs.Groups[1].FirstTaskIdx != 2 || ogs.Groups[1].Diff != want {
+		t.Fatalf("expected group of task 2 with diff: %q, got: %+v", want, ogs.Groups[1])
+	}
+	if !strings.Contains(outputGroupsString(ogs), "+FAIL") {
+		t.Fatalf("expected the diff in the statistics, got: %s", outputGroupsString(ogs))
+	}
+
+	t.Run("it should only count outputs beyond the limit", func(t *testing.T) {
+		og := newOutputGrouper(nil)
+		for i := 0; i < maxOutputGroups+5; i++ {
+			og.add(&Result{Idx: i, Output: strings.Repeat("x", i)})
+		}
+		ogs := og.stats()
+		if ogs.Distinct != maxOutputGroups || ogs.Ungrouped != 5 {
+			t.Fatalf("expected: %v groups and 5 ungrouped, got: %v and %v", maxOutputGroups, ogs.Distinct, ogs.Ungrouped)
+		}
+	})
+}
+
+func Test_configuredOper_run_groupOutputs(t *testing.T) {
+	c := configuredOper{
+		am:            6,
+		args:          []string{"sh", "-c", `echo "$(date +%s%N) done"`},
+		outputGroups:  newOutputGrouper(outputNormalizer{{re: normalizePresets["number"].re, replacement: "<number>"}}),
+		lowMemory:     true,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if stats.outputGroups == nil || !stats.outputGroups.Deterministic || stats.outputGroups.Attempts != 6 {
+		t.Fatalf("expected normalized outputs to be deterministic, got: %+v", stats.outputGroups)
+	}
+	if stats.summary().OutputGroups == nil {
+		t.Fatal("expected output groups in the summary")
+	}
+}
+
+func Test_configuredOper_run_groupOutputs_resultFile(t *testing.T) {
+	resultPath := t.TempDir() + "/results.jsonl"
+	f, err := os.Create(resultPath)
+	if err != nil {
+		t.Fatalf("failed to create result file: %v", err)
+	}
+	defer f.Close()
+	c := configuredOper{
+		am:            4,
+		args:          []string{"sh", "-c", "echo $((REPEATER_TASK_IDX % 2))"},
+		outputGroups:  newOutputGrouper(nil),
+		resultFile:    f,
+		resultFormat:  resultFormatJSONL,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if stats.outputGroups == nil || stats.outputGroups.Distinct != 2 || stats.outputGroups.Groups[1].Diff == "" {
+		t.Fatalf("expected 2 groups with a diff in the statistics, got: %+v", stats.outputGroups)
+	}
+
+	b, err := os.ReadFile(resultPath)
+	if err != nil {
+		t.Fatalf("failed to read result file: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected only the 4 results, got: %v lines", len(lines))
+	}
+	for _, line := range lines {
+		var res Result
+		if err := json.Unmarshal([]byte(line), &res); err != nil || res.OutputHash == "" {
+			t.Fatalf("expected a result with its output hash, got: %q, err: %v", line, err)
+		}
+	}
+}
+
+func Test_configuredOper_New_normalize(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{normalize: []string{"uuid"}})
+	if err == nil || !strings.Contains(err.Error(), "normalize") {
+		t.Fatalf("expected error for normalize without groupOutputs, got: %v", err)
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{groupOutputs: true, normalize: []string{"uuid"}})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.outputGroups == nil || len(c.outputGroups.normalizer) != 1 {
+		t.Fatalf("expected output grouper with one rule, got: %+v", c.outputGroups)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type outputKeep string
+
+const (
+	// keepHead keeps the first bytes of the output
+	keepHead outputKeep = "head"
+	// keepTail keeps the last bytes of the output
+	keepTail outputKeep = "tail"
+	// keepBoth keeps half of the limit from the start, and half from the end
+	keepBoth outputKeep = "both"
+)
+
+// byteSizeUnits are the units of parseByteSize, longest suffix first so that 'KiB'
+// isn't mistaken for 'B'
+var byteSizeUnits = []struct {
+	suffix string
+	factor int
+}{
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// parseByteSize on the format '<amount><unit>', such as '64KiB', '1MB' or '512'.
+// Empty means 0.
+func parseByteSize(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	factor := 1
+	amStr := s
+	for _, unit := range byteSizeUnits {
+		if trimmed, found := strings.CutSuffix(s, unit.suffix); found {
+			amStr = strings.TrimSpace(trimmed)
+			factor = unit.factor
+			break
+		}
+	}
+	am, err := strconv.Atoi(amStr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse size: %q, expected format such as '64KiB', '1MB' or '512': %w", s, err)
+	}
+	if am < 0 {
+		return 0, fmt.Errorf("size must be positive, got: %q", s)
+	}
+	return am * factor, nil
+}
+
+func parseOutputKeep(s string) (outputKeep, error) {
+	switch keep := outputKeep(s); keep {
+	case "":
+		return keepBoth, nil
+	case keepHead, keepTail, keepBoth:
+		return keep, nil
+	}
+	return "", fmt.Errorf("unrecognized output keep policy: %q, options are: ['%v', '%v', '%v']", s, keepHead, keepTail, keepBoth)
+}
+
+// outputLimit of each task. The zero value keeps all output.
+type outputLimit struct {
+	maxBytes int
+	keep     outputKeep
+	// spillDir is where the full output of truncated tasks is written, if set
+	spillDir string
+}
+
+func (ol outputLimit) String() string {
+	if ol.maxBytes == 0 {
+		return "unlimited"
+	}
+	ret := fmt.Sprintf("%v bytes, keep: %v", ol.maxBytes, ol.keep)
+	if ol.spillDir != "" {
+		ret += fmt.Sprintf(", full output in: %v", ol.spillDir)
+	}
+	return ret
+}
+
+type capturedChunk struct {
+	stream outputStream
+	event  OutputEvent
+}
+
+// outputCapture records the output of a task within the limit. Stdout and stderr may be
+// written concurrently.
+type outputCapture struct {
+	mu         sync.Mutex
+	limit      outputLimit
+	headBudget int
+	tailBudget int
+	head       []capturedChunk
+	headBytes  int
+	tail       []capturedChunk
+	tailBytes  int
+	total      int
+	spillPath  string
+	spill      *os.File
+	spillErr   error
+}
+
+// newOutputCapture of the task attempt. The spill file is only created once the output
+// exceeds the limit.
+func newOutputCapture(limit outputLimit, taskIdx, attempt int) *outputCapture {
+	oc := &outputCapture{limit: limit}
+	switch limit.keep {
+	case keepHead:
+		oc.headBudget = limit.maxBytes
+	case keepTail:
+		oc.tailBudget = limit.maxBytes
+	default:
+		oc.headBudget = limit.maxBytes / 2
+		oc.tailBudget = limit.maxBytes - oc.headBudget
+	}
+	if limit.spillDir != "" {
+		oc.spillPath = filepath.Join(limit.spillDir, fmt.Sprintf("task-%v-attempt-%v.log", taskIdx, attempt))
+	}
+	return oc
+}
+
+func (oc *outputCapture) write(stream outputStream, p []byte) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	at := time.Now().UTC()
+	if oc.total+len(p) > oc.limit.maxBytes {
+		oc.spillWrite(p)
+	}
+	oc.total += len(p)
+	if n := min(len(p), oc.headBudget-oc.headBytes); n > 0 {
+		oc.head = append(oc.head, capturedChunk{stream: stream, event: OutputEvent{At: at, Text: string(p[:n])}})
+		oc.headBytes += n
+		p = p[n:]
+	}
+	if len(p) == 0 || oc.tailBudget == 0 {
+		return
+	}
+	if len(p) > oc.tailBudget {
+		p = p[len(p)-oc.tailBudget:]
+	}
+	oc.tail = append(oc.tail, capturedChunk{stream: stream, event: OutputEvent{At: at, Text: string(p)}})
+	oc.tailBytes += len(p)
+	// Drop the oldest output of the tail until it fits
+	for oc.tailBytes > oc.tailBudget {
+		excess := oc.tailBytes - oc.tailBudget
+		first := &oc.tail[0]
+		if len(first.event.Text) <= excess {
+			oc.tailBytes -= len(first.event.Text)
+			oc.tail = oc.tail[1:]
+			continue
+		}
+		first.event.Text = first.event.Text[excess:]
+		oc.tailBytes -= excess
+	}
+}
+
+// spillWrite the bytes to the spill file. When the file is created, everything before
+// p is still kept in memory, so it's written first.
+func (oc *outputCapture) spillWrite(p []byte) {
+	if oc.spillPath == "" || oc.spillErr != nil {
+		return
+	}
+	if oc.spill == nil {
+		oc.spill, oc.spillErr = os.Create(oc.spillPath)
+		if oc.spillErr != nil {
+			return
+		}
+		for _, chunks := range [][]capturedChunk{oc.head, oc.tail} {
+			for _, chunk := range chunks {
+				oc.spill.WriteString(chunk.event.Text)
+			}
+		}
+	}
+	if _, err := oc.spill.Write(p); err != nil {
+		oc.spillErr = err
+	}
+}
+
+// finish by setting the captured output of the result, and closing the spill file
+func (oc *outputCapture) finish(res *Result) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+	var sb strings.Builder
+	addChunks := func(chunks []capturedChunk) {
+		for _, chunk := range chunks {
+			sb.WriteString(chunk.event.Text)
+			if chunk.stream == stdoutStream {
+				res.Stdout = append(res.Stdout, chunk.event)
+			} else {
+				res.Stderr = append(res.Stderr, chunk.event)
+			}
+		}
+	}
+	addChunks(oc.head)
+	if dropped := oc.total - oc.headBytes - oc.tailBytes; dropped > 0 {
+		res.Truncated = true
+		fmt.Fprintf(&sb, "\n[... %v bytes truncated ...]\n", dropped)
+	}
+	addChunks(oc.tail)
+	res.Output += sb.String()
+	if oc.spill != nil {
+		oc.spill.Close()
+		res.OutputFile = oc.spillPath
+	}
+	if oc.spillErr != nil {
+		printErr(fmt.Sprintf("failed to write full output of task: %v, to: %v, err: %v", res.Idx, oc.spillPath, oc.spillErr))
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_parseByteSize(t *testing.T) {
+	for input, want := range map[string]int{
+		"":      0,
+		"512":   512,
+		"20B":   20,
+		"64KiB": 64 << 10,
+		"1MB":   1000 * 1000,
+		"2 GiB": 2 << 30,
+	} {
+		got, err := parseByteSize(input)
+		if err != nil {
+			t.Fatalf("expected nil for: %q, got: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("expected: %v for: %q, got: %v", want, input, got)
+		}
+	}
+	for _, input := range []string{"KiB", "1.5MB", "-1", "ten"} {
+		if _, err := parseByteSize(input); err == nil {
+			t.Fatalf("expected error for: %q, got nil", input)
+		}
+	}
+}
+
+func Test_parseOutputKeep(t *testing.T) {
+	got, err := parseOutputKeep("")
+	if err != nil || got != keepBoth {
+		t.Fatalf("expected: %v, got: %v, err: %v", keepBoth, got, err)
+	}
+	if _, err := parseOutputKeep("middle"); err == nil {
+		t.Fatal("expected error for unrecognized policy, got nil")
+	}
+}
+
+func Test_outputCapture(t *testing.T) {
+	write := func(keep outputKeep, spillDir string) Result {
+		oc := newOutputCapture(outputLimit{maxBytes: 10, keep: keep, spillDir: spillDir}, 3, 1)
+		oc.write(stdoutStream, []byte("0123456"))
+		oc.write(stderrStream, []byte("789abc"))
+		oc.write(stdoutStream, []byte("defghij"))
+		var res Result
+		oc.finish(&res)
+		return res
+	}
+
+	t.Run("head", func(t *testing.T) {
+		res := write(keepHead, "")
+		if want := "0123456789\n[... 10 bytes truncated ...]\n"; res.Output != want {
+			t.Fatalf("expected: %q, got: %q", want, res.Output)
+		}
+		if !res.Truncated {
+			t.Fatal("expected result to be truncated")
+		}
+		if len(res.Stdout) != 1 || len(res.Stderr) != 1 || res.Stderr[0].Text != "789" {
+			t.Fatalf("expected output events to be kept per stream, got stdout: %v, stderr: %v", res.Stdout, res.Stderr)
+		}
+	})
+
+	t.Run("tail", func(t *testing.T) {
+		res := write(keepTail, "")
+		if want := "\n[... 10 bytes truncated ...]\nabcdefghij"; res.Output != want {
+			t.Fatalf("expected: %q, got: %q", want, res.Output)
+		}
+	})
+
+	t.Run("both", func(t *testing.T) {
+		res := write(keepBoth, "")
+		if want := "01234\n[... 10 bytes truncated ...]\nfghij"; res.Output != want {
+			t.Fatalf("expected: %q, got: %q", want, res.Output)
+		}
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		oc := newOutputCapture(outputLimit{maxBytes: 10, keep: keepBoth, spillDir: t.TempDir()}, 0, 1)
+		oc.write(stdoutStream, []byte("0123456789"))
+		var res Result
+		oc.finish(&res)
+		if res.Output != "0123456789" || res.Truncated || res.OutputFile != "" {
+			t.Fatalf("expected output to be kept as is, got: %+v", res)
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		res := write(keepBoth, t.TempDir())
+		if !strings.HasSuffix(res.OutputFile, "task-3-attempt-1.log") {
+			t.Fatalf("expected output file of the task attempt, got: %q", res.OutputFile)
+		}
+		b, err := os.ReadFile(res.OutputFile)
+		if err != nil {
+			t.Fatalf("failed to read output file: %v", err)
+		}
+		if want := "0123456789abcdefghij"; string(b) != want {
+			t.Fatalf("expected full output: %q, got: %q", want, b)
+		}
+	})
+}
+
+func Test_configuredOper_run_maxOutput(t *testing.T) {
+	spillDir := t.TempDir()
+	c := configuredOper{
+		am:            2,
+		args:          []string{"sh", "-c", "seq 1 1000"},
+		outputLimit:   outputLimit{maxBytes: 64, keep: keepBoth, spillDir: spillDir},
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	for _, res := range stats.Results {
+		if !res.Truncated || !strings.Contains(res.Output, "bytes truncated") {
+			t.Fatalf("expected truncated output, got: %q", res.Output)
+		}
+		if !strings.HasPrefix(res.Output, "1\n2\n") || !strings.HasSuffix(res.Output, "999\n1000\n") {
+			t.Fatalf("expected head and tail of the output, got: %q", res.Output)
+		}
+		b, err := os.ReadFile(res.OutputFile)
+		if err != nil {
+			t.Fatalf("failed to read output file: %v", err)
+		}
+		if !strings.HasPrefix(string(b), "1\n2\n") || !strings.Contains(string(b), "\n500\n") || !strings.HasSuffix(string(b), "\n1000\n") {
+			t.Fatal("expected the full output in the output file")
+		}
+	}
+}
+
+func Test_configuredOper_New_maxOutput(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{maxOutput: "lots", maxOutputKeep: "middle"})
+	if err == nil || !strings.Contains(err.Error(), "maxOutput") || !strings.Contains(err.Error(), "middle") {
+		t.Fatalf("expected errors for both maxOutput and maxOutputKeep, got: %v", err)
+	}
+	_, err = New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{outputSpillDir: t.TempDir()})
+	if err == nil {
+		t.Fatal("expected error as outputSpillDir requires maxOutput, got nil")
+	}
+	spillDir := t.TempDir() + "/nested/spill"
+	_, err = New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{maxOutput: "1KiB", outputSpillDir: spillDir})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if _, err := os.Stat(spillDir); err != nil {
+		t.Fatalf("expected spill dir to be created, got: %v", err)
+	}
+}
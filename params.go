@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// paramTable holds named parameters, one row per task. Each column is
+// referenced in the arguments as '{{<column>}}'.
+type paramTable struct {
+	columns []string
+	rows    [][]string
+	// cycle through the rows when they run out, instead of stopping
+	cycle bool
+	// repeat each row for this amount of consecutive tasks, set for matrix runs
+	repeat int
+}
+
+// readParamTable from a csv file, or a tsv file if the extension is '.tsv'. The header
+// row defines the column names.
+func readParamTable(path string, cycle bool) (*paramTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open params file: %w", err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		r.Comma = '\t'
+		r.LazyQuotes = true
+	}
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse params file: %w", err)
+	}
+	if len(records) < 2 {
+		return nil, fmt.Errorf("params file: %v, needs a header row and at least one row of parameters", path)
+	}
+	pt := &paramTable{
+		columns: records[0],
+		rows:    records[1:],
+		cycle:   cycle,
+	}
+	if err := pt.validate(); err != nil {
+		return nil, fmt.Errorf("params file: %v, is invalid: %w", path, err)
+	}
+	return pt, nil
+}
+
+func (pt *paramTable) validate() error {
+	seen := make(map[string]struct{}, len(pt.columns))
+	for i, col := range pt.columns {
+		col = strings.TrimSpace(col)
+		if col == "" {
+			return fmt.Errorf("column: %v, has no name", i)
+		}
+		if strings.ContainsAny(col, "{}") {
+			return fmt.Errorf("column: %q, may not contain '{' or '}'", col)
+		}
+		if _, exists := seen[col]; exists {
+			return fmt.Errorf("column: %q, is defined more than once", col)
+		}
+		seen[col] = struct{}{}
+		pt.columns[i] = col
+	}
+	if len(pt.rows) == 0 {
+		return errors.New("there are no rows")
+	}
+	return nil
+}
+
+// rowIdx of the task
+func (pt *paramTable) rowIdx(taskIdx int) int {
+	rowIdx := taskIdx / max(pt.repeat, 1)
+	if pt.cycle {
+		return rowIdx % len(pt.rows)
+	}
+	return rowIdx
+}
+
+// isMatrix returns true if the rows are the combinations of a matrix
+func (pt *paramTable) isMatrix() bool {
+	return pt.repeat > 0
+}
+
+// rowCombination of the row's parameters, such as 'size=1,threads=4'
+func (pt *paramTable) rowCombination(rowIdx int) string {
+	row := pt.rows[rowIdx]
+	parts := make([]string, 0, len(pt.columns))
+	for i, col := range pt.columns {
+		parts = append(parts, col+"="+row[i])
+	}
+	return strings.Join(parts, ",")
+}
+
+// values of the task, keyed by column name
+func (pt *paramTable) values(taskIdx int) map[string]string {
+	row := pt.rows[pt.rowIdx(taskIdx)]
+	ret := make(map[string]string, len(pt.columns))
+	for i, col := range pt.columns {
+		ret[col] = row[i]
+	}
+	return ret
+}
+
+// replaceParams by replacing each '{{<column>}}' with the value of the task's row,
+// quoted for the shell in shell mode
+func (c *configuredOper) replaceParams(args []string, i int) []string {
+	if c.params == nil {
+		return args
+	}
+	return c.params.replace(args, i, c.quoteArg)
+}
+
+// replace each '{{<column>}}' with the value of the task's row, quoted by quote unless it's nil
+func (pt *paramTable) replace(args []string, taskIdx int, quote func(string) string) []string {
+	values := pt.values(taskIdx)
+	replacements := make([]string, 0, 2*len(values))
+	for _, col := range pt.columns {
+		value := values[col]
+		if quote != nil {
+			value = quote(value)
+		}
+		replacements = append(replacements, paramPlaceholder(col), value)
+	}
+	replacer := strings.NewReplacer(replacements...)
+	newArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		newArgs = append(newArgs, replacer.Replace(arg))
+	}
+	return newArgs
+}
+
+func paramPlaceholder(column string) string {
+	return "{{" + column + "}}"
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func writeTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := fmt.Sprintf("%v/%v", t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write test file: %v", err)
+	}
+	return path
+}
+
+func Test_readParamTable(t *testing.T) {
+	t.Run("it should read csv with header row as columns", func(t *testing.T) {
+		path := writeTestFile(t, "params.csv", "user,region\nalice,eu\n\"bob, jr\",us\n")
+		got, err := readParamTable(path, false)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if !slices.Equal(got.columns, []string{"user", "region"}) {
+			t.Fatalf("unexpected columns: %q", got.columns)
+		}
+		if got.values(1)["user"] != "bob, jr" {
+			t.Fatalf("expected quoted value to be parsed, got: %q", got.values(1)["user"])
+		}
+	})
+
+	t.Run("it should read tsv based on extension", func(t *testing.T) {
+		path := writeTestFile(t, "params.tsv", "user\tregion\nalice\teu,west\n")
+		got, err := readParamTable(path, false)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if got.values(0)["region"] != "eu,west" {
+			t.Fatalf("expected tab separated value, got: %q", got.values(0)["region"])
+		}
+	})
+
+	t.Run("it should return error on bad files", func(t *testing.T) {
+		testCases := map[string]string{
+			"only header":      "user,region\n",
+			"duplicate column": "user,user\na,b\n",
+			"empty column":     "user,\na,b\n",
+			"ragged rows":      "user,region\na\n",
+		}
+		for desc, content := range testCases {
+			path := writeTestFile(t, "params.csv", content)
+			if _, err := readParamTable(path, false); err == nil {
+				t.Fatalf("for: %v, expected error, got nil", desc)
+			}
+		}
+	})
+}
+
+func Test_configuredOper_replaceParams(t *testing.T) {
+	c := configuredOper{
+		params: &paramTable{
+			columns: []string{"user", "region"},
+			rows:    [][]string{{"alice", "eu"}, {"bob", "us"}},
+			cycle:   true,
+		},
+	}
+	got := c.replaceParams([]string{"--user={{user}}", "{{region}}-{{user}}", "{{unknown}}"}, 3)
+	want := []string{"--user=bob", "us-bob", "{{unknown}}"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected: %q, got: %q", want, got)
+	}
+}
+
+func Test_configuredOper_New_params(t *testing.T) {
+	path := writeTestFile(t, "params.csv", "user\nalice\nbob\n")
+	args := []string{"echo", "{{user}}"}
+
+	t.Run("it should stop when rows run out", func(t *testing.T) {
+		c, err := New(5, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{params: path})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if c.am != 2 {
+			t.Fatalf("expected: 2, got: %v", c.am)
+		}
+	})
+
+	t.Run("it should keep amount of repetitions when cycling", func(t *testing.T) {
+		c, err := New(5, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{params: path, paramsCycle: true})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if c.am != 5 {
+			t.Fatalf("expected: 5, got: %v", c.am)
+		}
+	})
+
+	t.Run("it should return error if combined with input", func(t *testing.T) {
+		_, err := New(0, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{params: path, input: path})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func Test_configuredOper_run_params(t *testing.T) {
+	c := configuredOper{
+		am:   2,
+		args: []string{"printf", "%s", "{{user}}"},
+		params: &paramTable{
+			columns: []string{"user"},
+			rows:    [][]string{{"alice"}, {"bob"}},
+		},
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+
+	if len(stats.Results) != 2 {
+		t.Fatalf("expected 2 results, got: %v", len(stats.Results))
+	}
+	for _, r := range stats.Results {
+		if r.Output != r.Params["user"] {
+			t.Fatalf("expected result to record the params it ran with, got output: %q, params: %v", r.Output, r.Params)
+		}
+	}
+}
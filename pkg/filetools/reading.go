@@ -0,0 +1,24 @@
+package filetools
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReadLines from the reader, without line separators. Both '\n' and '\r\n' are
+// treated as line separators. A trailing line without line separator is included.
+func ReadLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	// Allow long lines, such as the ones of large json payloads
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to scan lines: %w", err)
+	}
+	return lines, nil
+}
@@ -0,0 +1,54 @@
+package filetools_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/baalimago/repeater/pkg/filetools"
+)
+
+func Test_ReadLines(t *testing.T) {
+	testCases := []struct {
+		desc  string
+		given string
+		want  []string
+	}{
+		{
+			desc:  "it should split on newlines",
+			given: "a\nb\nc\n",
+			want:  []string{"a", "b", "c"},
+		},
+		{
+			desc:  "it should include trailing line without newline",
+			given: "a\nb",
+			want:  []string{"a", "b"},
+		},
+		{
+			desc:  "it should strip carriage returns",
+			given: "a\r\nb\r\n",
+			want:  []string{"a", "b"},
+		},
+		{
+			desc:  "it should keep empty lines",
+			given: "a\n\nb\n",
+			want:  []string{"a", "", "b"},
+		},
+		{
+			desc:  "it should return no lines for empty input",
+			given: "",
+			want:  []string{},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := filetools.ReadLines(strings.NewReader(tc.given))
+			if err != nil {
+				t.Fatalf("expected nil, got: %v", err)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("expected: %q, got: %q", tc.want, got)
+			}
+		})
+	}
+}
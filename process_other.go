@@ -0,0 +1,22 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// killProcessGroupOnCancel is a no-op on platforms without process groups, the
+// command itself is still killed once its context is done.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
+
+// exitSignal is always empty on platforms without signals
+func exitSignal(ps *os.ProcessState) string {
+	return ""
+}
+
+// maxRSS is always 0 on platforms without rusage
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
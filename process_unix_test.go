@@ -0,0 +1,36 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_configuredOper_doWork_processGroup(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("requires /proc to read the process group")
+	}
+	pgid := func(t *testing.T, c configuredOper) int {
+		t.Helper()
+		c.args = []string{"sh", "-c", "cut -d' ' -f5 /proc/self/stat"}
+		res := c.doWork(context.Background(), 0, 0, 1, nil)
+		got, err := strconv.Atoi(strings.TrimSpace(res.Output))
+		if err != nil {
+			t.Fatalf("failed to parse process group: %q, err: %v", res.Output, err)
+		}
+		return got
+	}
+
+	if got := pgid(t, configuredOper{}); got != syscall.Getpgrp() {
+		t.Fatalf("expected task to stay in the process group: %v, got: %v", syscall.Getpgrp(), got)
+	}
+	if got := pgid(t, configuredOper{timeout: time.Minute}); got == syscall.Getpgrp() {
+		t.Fatal("expected task with timeout to be in its own process group")
+	}
+}
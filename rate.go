@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// parseRate parses a rate on the format '<amount>/<unit>', such as '50/s', '300/m'
+// or '5/100ms'. A rate without unit is interpreted as per second. Returns the
+// amount of tasks per second, or 0 if s is empty.
+func parseRate(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	amStr, unit, hasUnit := strings.Cut(s, "/")
+	if !hasUnit {
+		unit = "s"
+	}
+	am, err := strconv.ParseFloat(strings.TrimSpace(amStr), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse amount of rate: %q, err: %w", s, err)
+	}
+	if am <= 0 {
+		return 0, fmt.Errorf("rate must be positive, got: %q", s)
+	}
+	unit = strings.TrimSpace(unit)
+	// Allow units without a leading quantity, such as 's' or 'm'
+	if unit == "" || !strings.ContainsAny(unit[:1], "0123456789.") {
+		unit = "1" + unit
+	}
+	per, err := time.ParseDuration(unit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse unit of rate: %q, err: %w", s, err)
+	}
+	if per <= 0 {
+		return 0, fmt.Errorf("rate unit must be positive, got: %q", s)
+	}
+	return am / per.Seconds(), nil
+}
+
+// rateLimiter paces tasks at a fixed interval. Time which isn't used isn't
+// saved up, so the limiter never bursts above the configured rate.
+type rateLimiter struct {
+	interval time.Duration
+	mu       *sync.Mutex
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		mu:       &sync.Mutex{},
+	}
+}
+
+// wait until the next slot is available, or the context is cancelled. Safe to
+// call concurrently.
+func (rl *rateLimiter) wait(ctx context.Context) error {
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	slot := rl.next
+	rl.next = rl.next.Add(rl.interval)
+	rl.mu.Unlock()
+
+	waitFor := time.Until(slot)
+	if waitFor <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(waitFor)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateString formats a rate in tasks per second, 0 is presented as unlimited
+func rateString(perSecond float64) string {
+	if perSecond <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.2f/s", perSecond)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_parseRate(t *testing.T) {
+	testCases := []struct {
+		given   string
+		want    float64
+		wantErr bool
+	}{
+		{given: "", want: 0},
+		{given: "50/s", want: 50},
+		{given: "50", want: 50},
+		{given: "120/m", want: 2},
+		{given: "3600/h", want: 1},
+		{given: "5/100ms", want: 50},
+		{given: "0/s", wantErr: true},
+		{given: "-1/s", wantErr: true},
+		{given: "abc/s", wantErr: true},
+		{given: "5/fortnight", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.given, func(t *testing.T) {
+			got, err := parseRate(tc.given)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got rate: %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected nil, got: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("expected: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func Test_rateLimiter(t *testing.T) {
+	t.Run("it should pace calls at the configured interval", func(t *testing.T) {
+		rl := newRateLimiter(100)
+		start := time.Now()
+		for i := 0; i < 11; i++ {
+			if err := rl.wait(context.Background()); err != nil {
+				t.Fatalf("expected nil, got: %v", err)
+			}
+		}
+		// First slot is immediate, the following 10 are spaced 10ms apart
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Fatalf("expected at least 100ms to pass, got: %v", elapsed)
+		}
+	})
+
+	t.Run("it should return on context cancel", func(t *testing.T) {
+		rl := newRateLimiter(0.1)
+		ctx, cancel := context.WithCancel(context.Background())
+		_ = rl.wait(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := rl.wait(ctx); err == nil {
+			t.Fatal("expected context error, got nil")
+		}
+	})
+}
+
+func Test_configuredOper_run_rate(t *testing.T) {
+	amTasks := 5
+	c := configuredOper{
+		am:            amTasks,
+		workers:       amTasks,
+		amIdleWorkers: amTasks,
+		args:          []string{"true"},
+		rate:          50,
+		limiter:       newRateLimiter(50),
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(amTasks)
+
+	start := time.Now()
+	stats := c.run(context.Background())
+	elapsed := time.Since(start)
+
+	if stats.amDone != amTasks {
+		t.Fatalf("expected: %v tasks done, got: %v", amTasks, stats.amDone)
+	}
+	// 5 tasks at 50/s should be spread over at least 80ms, even with 5 workers
+	if elapsed < 80*time.Millisecond {
+		t.Fatalf("expected rate to throttle dispatch, finished in: %v", elapsed)
+	}
+}
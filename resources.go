@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// resourceStats summarizes the resource usage of the successful attempts, as reported by
+// the operating system once each process exits
+type resourceStats struct {
+	// Measured is the amount of attempts whose resource usage is known
+	Measured int `json:"measured"`
+	// AverageCPU is the average of the user and system CPU time
+	AverageCPU     time.Duration `json:"averageCPU"`
+	CPUPercentiles []percentile  `json:"cpuPercentiles"`
+	// CPUUtilization is the total CPU time divided by the total runtime. It exceeds 1 if
+	// the commands use more than one core.
+	CPUUtilization float64 `json:"cpuUtilization"`
+	// PeakRSS is the largest max resident set size in bytes, 0 if it's not reported by
+	// the platform
+	PeakRSS        int64 `json:"peakRSS"`
+	PeakRSSTaskIdx int   `json:"peakRSSTaskIdx"`
+	AverageRSS     int64 `json:"averageRSS"`
+}
+
+// cpuTime of the attempt, in user and system mode
+func (r *Result) cpuTime() time.Duration {
+	return r.UserTime + r.SystemTime
+}
+
+// hasResourceUsage is true if the attempt ran to completion, and should be counted in
+// the resource statistics
+func (r *Result) hasResourceUsage() bool {
+	return r.PID != 0 && !r.isFailure() && !r.IsCancelled
+}
+
+// resourceAccumulator sums up the resource usage of attempts one at a time. The CPU
+// time percentiles are exact if the CPU times are kept, and estimated by a sketch if not.
+type resourceAccumulator struct {
+	measured       int
+	totalCPU       time.Duration
+	totalRuntime   time.Duration
+	totalRSS       int64
+	peakRSS        int64
+	peakRSSTaskIdx int
+	cpuTimes       []time.Duration
+	cpuSketch      *quantileSketch
+}
+
+func (ra *resourceAccumulator) add(r Result) {
+	if !r.hasResourceUsage() {
+		return
+	}
+	ra.measured++
+	ra.totalCPU += r.cpuTime()
+	ra.totalRuntime += r.Runtime
+	ra.totalRSS += r.MaxRSS
+	if r.MaxRSS > ra.peakRSS {
+		ra.peakRSS = r.MaxRSS
+		ra.peakRSSTaskIdx = r.Idx
+	}
+	if ra.cpuSketch != nil {
+		ra.cpuSketch.add(r.cpuTime())
+	} else {
+		ra.cpuTimes = append(ra.cpuTimes, r.cpuTime())
+	}
+}
+
+// stats of the added attempts, nil if none were measured
+func (ra *resourceAccumulator) stats() *resourceStats {
+	if ra.measured == 0 {
+		return nil
+	}
+	rs := &resourceStats{
+		Measured:       ra.measured,
+		AverageCPU:     ra.totalCPU / time.Duration(ra.measured),
+		PeakRSS:        ra.peakRSS,
+		PeakRSSTaskIdx: ra.peakRSSTaskIdx,
+		AverageRSS:     ra.totalRSS / int64(ra.measured),
+	}
+	if ra.totalRuntime > 0 {
+		rs.CPUUtilization = float64(ra.totalCPU) / float64(ra.totalRuntime)
+	}
+	if ra.cpuSketch != nil {
+		rs.CPUPercentiles = ra.cpuSketch.percentiles()
+	} else {
+		sorted := slices.Clone(ra.cpuTimes)
+		slices.Sort(sorted)
+		rs.CPUPercentiles = calcPercentiles(sorted)
+	}
+	return rs
+}
+
+// calcResourceStats of the results, nil if none were measured
+func calcResourceStats(results []Result) *resourceStats {
+	var ra resourceAccumulator
+	for _, r := range results {
+		ra.add(r)
+	}
+	return ra.stats()
+}
+
+func resourcesString(rs *resourceStats, estimated bool) string {
+	if rs == nil {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "\n  CPU time (user + system), average: %v, utilization: %.1f%%\n  CPU time percentiles%v, %v",
+		rs.AverageCPU, rs.CPUUtilization*100, estimatedString(estimated), percentilesString(rs.CPUPercentiles))
+	if rs.PeakRSS > 0 {
+		fmt.Fprintf(&sb, "\n  Peak memory (max RSS), index: %v, size: %v, average: %v",
+			rs.PeakRSSTaskIdx, formatByteSize(rs.PeakRSS), formatByteSize(rs.AverageRSS))
+	}
+	return sb.String()
+}
+
+// formatByteSize in the largest binary unit which keeps it at least 1, such as '1.5MiB'
+func formatByteSize(b int64) string {
+	units := []string{"KiB", "MiB", "GiB", "TiB"}
+	if b < 1<<10 {
+		return fmt.Sprintf("%vB", b)
+	}
+	size := float64(b)
+	unit := ""
+	for _, u := range units {
+		if size < 1<<10 {
+			break
+		}
+		size /= 1 << 10
+		unit = u
+	}
+	return fmt.Sprintf("%.1f%v", size, unit)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func Test_formatByteSize(t *testing.T) {
+	for b, want := range map[int64]string{
+		0:                       "0B",
+		512:                     "512B",
+		1536:                    "1.5KiB",
+		37 << 20:                "37.0MiB",
+		3 << 30:                 "3.0GiB",
+		5 << 40:                 "5.0TiB",
+		int64(1.25 * (1 << 20)): "1.2MiB",
+	} {
+		if got := formatByteSize(b); got != want {
+			t.Fatalf("expected: %q for: %v, got: %q", want, b, got)
+		}
+	}
+}
+
+func Test_calcResourceStats(t *testing.T) {
+	if calcResourceStats([]Result{{Idx: 0}}) != nil {
+		t.Fatal("expected nil for attempts which never started")
+	}
+	results := []Result{
+		{Idx: 0, PID: 1, Runtime: 100 * time.Millisecond, UserTime: 30 * time.Millisecond, SystemTime: 10 * time.Millisecond, MaxRSS: 1 << 20},
+		{Idx: 1, PID: 2, Runtime: 100 * time.Millisecond, UserTime: 50 * time.Millisecond, SystemTime: 10 * time.Millisecond, MaxRSS: 3 << 20},
+		// Failures aren't counted, same as the runtime statistics
+		{Idx: 2, PID: 3, Runtime: time.Second, UserTime: time.Second, MaxRSS: 1 << 30, IsError: true},
+	}
+	got := calcResourceStats(results)
+	if got.Measured != 2 {
+		t.Fatalf("expected: 2 measured, got: %v", got.Measured)
+	}
+	if got.AverageCPU != 50*time.Millisecond {
+		t.Fatalf("expected average cpu: 50ms, got: %v", got.AverageCPU)
+	}
+	if got.CPUUtilization != 0.5 {
+		t.Fatalf("expected utilization: 0.5, got: %v", got.CPUUtilization)
+	}
+	if got.PeakRSS != 3<<20 || got.PeakRSSTaskIdx != 1 || got.AverageRSS != 2<<20 {
+		t.Fatalf("expected peak rss of task 1 with average 2MiB, got: %+v", got)
+	}
+	if percentileOf(got.CPUPercentiles, 50) != 40*time.Millisecond {
+		t.Fatalf("expected p50: 40ms, got: %v", got.CPUPercentiles)
+	}
+
+	agg := newAggregator(retryPolicy{}, histogramSpec{amBuckets: 1})
+	for _, r := range results {
+		agg.add(r)
+	}
+	estimated := agg.statistics(3).resources
+	if estimated.Measured != got.Measured || estimated.PeakRSS != got.PeakRSS || estimated.AverageCPU != got.AverageCPU {
+		t.Fatalf("expected aggregated: %+v, to match exact: %+v", estimated, got)
+	}
+}
+
+func Test_configuredOper_doWork_resourceUsage(t *testing.T) {
+	// Burn some CPU in the shell itself, so that the user time is measurable
+	c := configuredOper{args: []string{"sh", "-c", "i=0; while [ $i -lt 20000 ]; do i=$((i+1)); done"}}
+	res := c.doWork(context.Background(), 0, 0, 1, nil)
+	if res.IsError {
+		t.Fatalf("expected success, got: %v", res.Error)
+	}
+	if res.cpuTime() <= 0 {
+		t.Fatalf("expected cpu time to be recorded, got user: %v, system: %v", res.UserTime, res.SystemTime)
+	}
+	if runtime.GOOS == "linux" && res.MaxRSS <= 0 {
+		t.Fatalf("expected max rss to be recorded, got: %v", res.MaxRSS)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+type backoffStrategy string
+
+const (
+	backoffConst  backoffStrategy = "const"
+	backoffLinear backoffStrategy = "linear"
+	backoffExp    backoffStrategy = "exp"
+)
+
+// unlimitedAttempts retries a task until it succeeds
+const unlimitedAttempts = -1
+
+// maxBackoffDoublings caps the exponential backoff so that it doesn't overflow
+const maxBackoffDoublings = 30
+
+// maxRetryDelay caps the delay between attempts, before jitter, so that large delays
+// don't overflow
+const maxRetryDelay = 24 * time.Hour
+
+func parseBackoff(s string) (backoffStrategy, error) {
+	switch b := backoffStrategy(s); b {
+	case "":
+		return backoffConst, nil
+	case backoffConst, backoffLinear, backoffExp:
+		return b, nil
+	default:
+		return "", fmt.Errorf("unrecognized backoff: %q, valid options are ['%v', '%v', '%v']", s, backoffConst, backoffLinear, backoffExp)
+	}
+}
+
+// retryPolicy decides if, and when, a failed task should be attempted again.
+// Retries are made on the same task index.
+type retryPolicy struct {
+	// maxAttempts of each task, including the first one. Negative means unlimited,
+	// 0 is treated as 1.
+	maxAttempts int
+	backoff     backoffStrategy
+	base        time.Duration
+	// jitter is the fraction, [0, 1], which the delay is randomly adjusted by
+	jitter float64
+}
+
+// shouldRetry returns true if there may be another attempt after the attempt
+func (rp retryPolicy) shouldRetry(attempt int) bool {
+	return rp.maxAttempts < 0 || attempt < rp.maxAttempts
+}
+
+// enabled returns true if tasks may be attempted more than once
+func (rp retryPolicy) enabled() bool {
+	return rp.maxAttempts < 0 || rp.maxAttempts > 1
+}
+
+// delay before the attempt following the failed attempt. Attempts start at 1.
+func (rp retryPolicy) delay(attempt int) time.Duration {
+	d := rp.base
+	switch rp.backoff {
+	case backoffLinear:
+		if attempt > 0 && rp.base > maxRetryDelay/time.Duration(attempt) {
+			d = maxRetryDelay
+		} else {
+			d = rp.base * time.Duration(attempt)
+		}
+	case backoffExp:
+		doublings := max(min(attempt-1, maxBackoffDoublings), 0)
+		if rp.base > maxRetryDelay>>doublings {
+			d = maxRetryDelay
+		} else {
+			d = rp.base << doublings
+		}
+	}
+	d = min(d, maxRetryDelay)
+	if rp.jitter > 0 {
+		d = time.Duration(float64(d) * (1 + rp.jitter*(2*rand.Float64()-1)))
+	}
+	return d
+}
+
+// wait for the delay following the failed attempt, or until ctx is done
+func (rp retryPolicy) wait(ctx context.Context, attempt int) error {
+	d := rp.delay(attempt)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (rp retryPolicy) String() string {
+	if !rp.enabled() {
+		return "disabled"
+	}
+	maxAttempts := "unlimited"
+	if rp.maxAttempts > 0 {
+		maxAttempts = fmt.Sprintf("%v", rp.maxAttempts)
+	}
+	return fmt.Sprintf("max attempts: %v, backoff: %v, base: %v, jitter: %v", maxAttempts, rp.backoff, rp.base, rp.jitter)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_parseBackoff(t *testing.T) {
+	for _, given := range []string{"", "const", "linear", "exp"} {
+		if _, err := parseBackoff(given); err != nil {
+			t.Fatalf("expected nil for: %q, got: %v", given, err)
+		}
+	}
+	if _, err := parseBackoff("fibonacci"); err == nil {
+		t.Fatal("expected error for unrecognized backoff, got nil")
+	}
+}
+
+func Test_retryPolicy(t *testing.T) {
+	t.Run("it should calculate delay according to strategy", func(t *testing.T) {
+		testCases := []struct {
+			backoff backoffStrategy
+			attempt int
+			want    time.Duration
+		}{
+			{backoffConst, 1, 100 * time.Millisecond},
+			{backoffConst, 4, 100 * time.Millisecond},
+			{backoffLinear, 1, 100 * time.Millisecond},
+			{backoffLinear, 4, 400 * time.Millisecond},
+			{backoffExp, 1, 100 * time.Millisecond},
+			{backoffExp, 4, 800 * time.Millisecond},
+		}
+		for _, tc := range testCases {
+			rp := retryPolicy{backoff: tc.backoff, base: 100 * time.Millisecond}
+			if got := rp.delay(tc.attempt); got != tc.want {
+				t.Fatalf("for: %v, attempt: %v, expected: %v, got: %v", tc.backoff, tc.attempt, tc.want, got)
+			}
+		}
+	})
+
+	t.Run("it should keep jittered delay within bounds", func(t *testing.T) {
+		rp := retryPolicy{backoff: backoffConst, base: 100 * time.Millisecond, jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			got := rp.delay(1)
+			if got < 50*time.Millisecond || got > 150*time.Millisecond {
+				t.Fatalf("expected delay within [50ms, 150ms], got: %v", got)
+			}
+		}
+	})
+
+	t.Run("it should not overflow on many exponential attempts", func(t *testing.T) {
+		rp := retryPolicy{backoff: backoffExp, base: time.Millisecond}
+		if got := rp.delay(1000); got <= 0 {
+			t.Fatalf("expected positive delay, got: %v", got)
+		}
+	})
+
+	t.Run("it should cap large delays", func(t *testing.T) {
+		testCases := []struct {
+			backoff backoffStrategy
+			base    time.Duration
+			attempt int
+		}{
+			{backoffExp, 10 * time.Second, 31},
+			{backoffExp, 10 * time.Hour, 5},
+			{backoffExp, 10 * time.Hour, 1000},
+			{backoffLinear, 10 * time.Hour, 5},
+			{backoffLinear, time.Hour, 1 << 40},
+		}
+		for _, tc := range testCases {
+			rp := retryPolicy{backoff: tc.backoff, base: tc.base}
+			if got := rp.delay(tc.attempt); got != maxRetryDelay {
+				t.Fatalf("for: %v, base: %v, attempt: %v, expected: %v, got: %v", tc.backoff, tc.base, tc.attempt, maxRetryDelay, got)
+			}
+		}
+	})
+
+	t.Run("it should respect max attempts", func(t *testing.T) {
+		testCases := []struct {
+			maxAttempts int
+			attempt     int
+			want        bool
+		}{
+			{0, 1, false},
+			{1, 1, false},
+			{3, 2, true},
+			{3, 3, false},
+			{unlimitedAttempts, 1000, true},
+		}
+		for _, tc := range testCases {
+			rp := retryPolicy{maxAttempts: tc.maxAttempts}
+			if got := rp.shouldRetry(tc.attempt); got != tc.want {
+				t.Fatalf("for max attempts: %v, attempt: %v, expected: %v, got: %v", tc.maxAttempts, tc.attempt, tc.want, got)
+			}
+		}
+	})
+}
+
+func Test_configuredOper_run_retry(t *testing.T) {
+	t.Run("it should retry failing tasks on the same index until they succeed", func(t *testing.T) {
+		dir := t.TempDir()
+		amTasks := 3
+		c := configuredOper{
+			am:        amTasks,
+			increment: true,
+			// Fails the first two attempts of each task index
+			args: []string{"sh", "-c", fmt.Sprintf(
+				`f=%v/INC; n=$(cat $f 2>/dev/null || echo 0); n=$((n+1)); echo $n > $f; [ $n -ge 3 ]`, dir)},
+			retry:         retryPolicy{maxAttempts: 5, backoff: backoffConst, base: time.Millisecond},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+
+		stats := c.run(context.Background())
+
+		attemptsPerIdx := make(map[int][]int)
+		for _, r := range stats.Results {
+			attemptsPerIdx[r.Idx] = append(attemptsPerIdx[r.Idx], r.Attempt)
+		}
+		for i := 0; i < amTasks; i++ {
+			if got := len(attemptsPerIdx[i]); got != 3 {
+				t.Fatalf("expected 3 attempts for index: %v, got: %v", i, attemptsPerIdx[i])
+			}
+		}
+		if stats.amRetried != amTasks {
+			t.Fatalf("expected: %v retried tasks, got: %v", amTasks, stats.amRetried)
+		}
+		if stats.amExhausted != 0 {
+			t.Fatalf("expected no exhausted tasks, got: %v", stats.amExhausted)
+		}
+	})
+
+	t.Run("it should give up once max attempts are exhausted", func(t *testing.T) {
+		c := configuredOper{
+			am:            2,
+			args:          []string{"false"},
+			retry:         retryPolicy{maxAttempts: 3},
+			amIdleWorkers: 1,
+			workPlanMu:    &sync.Mutex{},
+			workerWg:      &sync.WaitGroup{},
+		}
+		c.workerWg.Add(1)
+
+		stats := c.run(context.Background())
+
+		if stats.amDone != 6 {
+			t.Fatalf("expected 6 attempts, got: %v", stats.amDone)
+		}
+		if stats.amExhausted != 2 {
+			t.Fatalf("expected 2 exhausted tasks, got: %v", stats.amExhausted)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// DefaultShellCommand runs the command line in shell mode
+const DefaultShellCommand = "/bin/sh -c"
+
+// shellQuoteFunc is the template function which quotes the output of actions in shell mode
+const shellQuoteFunc = "shellQuote"
+
+// parseShellCommand into the arguments which the command line is appended to, such as
+// ['/bin/sh', '-c']
+func parseShellCommand(s string) ([]string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, errors.New("shell command is empty, expected something like '/bin/sh -c'")
+	}
+	return fields, nil
+}
+
+// shellQuote the value so that the shell interprets it as a single word. Values which
+// only contain characters without special meaning are left as is.
+func shellQuote(v any) string {
+	s := fmt.Sprint(v)
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, needsShellQuote) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsShellQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("_@%+=:,./-", r)
+}
+
+// quoteArg for the shell if running in shell mode
+func (c *configuredOper) quoteArg(s string) string {
+	if !c.shell {
+		return s
+	}
+	return shellQuote(s)
+}
+
+// commandLine of the expanded arguments, quoted so that it may be pasted into a shell.
+// In shell mode, this is the command line run by the shell.
+func (c *configuredOper) commandLine(args []string) string {
+	if c.shell {
+		return args[len(args)-1]
+	}
+	return quoteArgv(append([]string{c.args[0]}, args...))
+}
+
+// quoteArgv by quoting each argument for the shell and joining them with spaces
+func quoteArgv(argv []string) string {
+	quoted := make([]string, 0, len(argv))
+	for _, arg := range argv {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteTemplateActions by piping the output of every action of the template through
+// shellQuote. Actions which only declare variables, already quote, or only call one of the
+// skipped functions are left as is.
+func quoteTemplateActions(tmpl *template.Template, skip map[string]bool) {
+	if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+		return
+	}
+	quoteListActions(tmpl.Tree, tmpl.Tree.Root, skip)
+}
+
+func quoteListActions(tree *parse.Tree, list *parse.ListNode, skip map[string]bool) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.ActionNode:
+			quoteAction(tree, n, skip)
+		case *parse.IfNode:
+			quoteListActions(tree, n.List, skip)
+			quoteListActions(tree, n.ElseList, skip)
+		case *parse.RangeNode:
+			quoteListActions(tree, n.List, skip)
+			quoteListActions(tree, n.ElseList, skip)
+		case *parse.WithNode:
+			quoteListActions(tree, n.List, skip)
+			quoteListActions(tree, n.ElseList, skip)
+		}
+	}
+}
+
+func quoteAction(tree *parse.Tree, action *parse.ActionNode, skip map[string]bool) {
+	pipe := action.Pipe
+	if pipe == nil || len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+		return
+	}
+	last := pipe.Cmds[len(pipe.Cmds)-1]
+	if ident, isIdent := last.Args[0].(*parse.IdentifierNode); isIdent {
+		if ident.Ident == shellQuoteFunc || (len(pipe.Cmds) == 1 && len(last.Args) == 1 && skip[ident.Ident]) {
+			return
+		}
+	}
+	quote := &parse.CommandNode{
+		NodeType: parse.NodeCommand,
+		Pos:      action.Pos,
+		Args:     []parse.Node{parse.NewIdentifier(shellQuoteFunc).SetTree(tree).SetPos(action.Pos)},
+	}
+	pipe.Cmds = append(pipe.Cmds, quote)
+}
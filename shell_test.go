@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_shellQuote(t *testing.T) {
+	testCases := []struct {
+		given any
+		want  string
+	}{
+		{"plain", "plain"},
+		{42, "42"},
+		{"./path/to-file_1.txt", "./path/to-file_1.txt"},
+		{"", "''"},
+		{"two words", "'two words'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME; rm -rf /", "'$HOME; rm -rf /'"},
+	}
+	for _, tc := range testCases {
+		if got := shellQuote(tc.given); got != tc.want {
+			t.Fatalf("for: %q, expected: %q, got: %q", tc.given, tc.want, got)
+		}
+	}
+}
+
+func Test_parseArgTemplates_quote(t *testing.T) {
+	params := &paramTable{columns: []string{"user"}, rows: [][]string{{"a b"}}}
+	tmpls, err := parseArgTemplates([]string{
+		`echo {{.Line}} {{.Line | shellQuote}} {{$x := .Line}}{{if true}}{{$x}}{{end}} {{user}}`,
+	}, params, true)
+	if err != nil {
+		t.Fatalf("failed to parse templates: %v", err)
+	}
+	c := configuredOper{shell: true, params: params, lines: []string{"x'y"}}
+	got, err := executeTemplates(tmpls, c.templateData(0, 0, 1))
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	got = c.replaceParams(got, 0)
+	want := `echo 'x'\''y' 'x'\''y' 'x'\''y' 'a b'`
+	if got[0] != want {
+		t.Fatalf("expected: %q, got: %q", want, got[0])
+	}
+}
+
+func Test_configuredOper_New_shell(t *testing.T) {
+	t.Run("it should join the arguments into one command line", func(t *testing.T) {
+		c, err := New(1, 1, []string{"echo a", "|", "wc -c"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{shell: true})
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		want := []string{"/bin/sh", "-c", "echo a | wc -c"}
+		if !slices.Equal(c.args, want) {
+			t.Fatalf("expected: %q, got: %q", want, c.args)
+		}
+	})
+
+	t.Run("it should return error on empty shell command", func(t *testing.T) {
+		_, err := New(1, 1, []string{"echo"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{shell: true, shellCommand: " "})
+		if err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func Test_configuredOper_run_shell(t *testing.T) {
+	lines := []string{"plain", "it's $HOME"}
+	c := configuredOper{
+		am:            len(lines),
+		args:          []string{"/bin/sh", "-c", "printf %s {} | tr a-z A-Z && printf INC"},
+		lines:         lines,
+		increment:     true,
+		shell:         true,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	want := map[int]struct{ output, command string }{
+		0: {"PLAIN0", "printf %s plain | tr a-z A-Z && printf 0"},
+		1: {"IT'S $HOME1", `printf %s 'it'\''s $HOME' | tr a-z A-Z && printf 1`},
+	}
+	for _, r := range stats.Results {
+		if r.Output != want[r.Idx].output || r.Command != want[r.Idx].command {
+			t.Fatalf("expected output: %q, command: %q, got output: %q, command: %q", want[r.Idx].output, want[r.Idx].command, r.Output, r.Command)
+		}
+	}
+}
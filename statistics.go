@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"time"
@@ -12,15 +13,53 @@ type OutputEvent struct {
 }
 
 type Result struct {
-	WorkerID             int           `json:"workerID"`
-	Idx                  int           `json:"taskIdx"`
-	Runtime              time.Duration `json:"runtime"`
-	RuntimeHumanReadable string        `json:"runtimeHumanReadable"`
-	Output               string        `json:"output"`
-	Stdout               []OutputEvent `json:"stdout,omitempty"`
-	Stderr               []OutputEvent `json:"stderr,omitempty"`
-	IsError              bool          `json:"isError"`
-	IsCancelled          bool          `json:"isCancelled"`
+	WorkerID             int               `json:"workerID"`
+	Idx                  int               `json:"taskIdx"`
+	Attempt              int               `json:"attempt"`
+	Input                string            `json:"input,omitempty"`
+	Params               map[string]string `json:"params,omitempty"`
+	Command              string            `json:"command"`
+	Runtime              time.Duration     `json:"runtime"`
+	RuntimeHumanReadable string            `json:"runtimeHumanReadable"`
+	Output               string            `json:"output"`
+	Stdout               []OutputEvent     `json:"stdout,omitempty"`
+	Stderr               []OutputEvent     `json:"stderr,omitempty"`
+	IsError              bool              `json:"isError"`
+	IsCancelled          bool              `json:"isCancelled"`
+	IsTimeout            bool              `json:"isTimeout"`
+	// ExitCode of the process, or -1 if it didn't exit by itself, such as when it was
+	// killed by a signal or never started
+	ExitCode int `json:"exitCode"`
+	// Signal which terminated the process, if any
+	Signal string `json:"signal,omitempty"`
+	// PID of the process, if it was started
+	PID       int       `json:"pid,omitempty"`
+	StartedAt time.Time `json:"startedAt"`
+	EndedAt   time.Time `json:"endedAt"`
+	// UserTime and SystemTime is the CPU time of the process and its waited for children
+	UserTime   time.Duration `json:"userTime"`
+	SystemTime time.Duration `json:"systemTime"`
+	// MaxRSS is the max resident set size of the process in bytes, 0 if it's not reported
+	// by the platform
+	MaxRSS int64 `json:"maxRSS,omitempty"`
+	// Argv of the process, with every placeholder expanded
+	Argv []string `json:"argv,omitempty"`
+	// Error of the attempt, such as 'exit status 1', if it failed
+	Error string `json:"error,omitempty"`
+	// Truncated is true if the output exceeded the limit, and was cut
+	Truncated bool `json:"truncated,omitempty"`
+	// OutputFile holds the full output of a truncated task, if spilling is enabled
+	OutputFile string `json:"outputFile,omitempty"`
+	// OutputDir of the task, where its stdout and stderr are written, if outputDir is set
+	OutputDir string `json:"outputDir,omitempty"`
+	// Rule of the success criteria which decided the outcome, if success criteria are set
+	Rule string `json:"rule,omitempty"`
+	// OutputHash of the normalized output, shared by every attempt in the same output
+	// group, if groupOutputs is set
+	OutputHash string `json:"outputHash,omitempty"`
+	// taggedOutput is the output with each line prefixed by the tag of the task, if tag
+	// is set. It's only written as output, never kept.
+	taggedOutput string
 }
 
 type statistics struct {
@@ -28,14 +67,38 @@ type statistics struct {
 	amDone      int
 	amFails     int
 	amCancelled int
-	cancelled   bool
-	max         Result
-	min         Result
-	total       time.Duration
-	runtime     time.Duration
-	average     time.Duration
-	stdDev      time.Duration
-	Results     []Result `json:"results"`
+	amTimeouts  int
+	amRetried   int
+	amExhausted int
+	// amFailedTasks which failed on their final attempt
+	amFailedTasks int
+	retries       bool
+	haltReason    string
+	cancelled     bool
+	max           Result
+	min           Result
+	total         time.Duration
+	runtime       time.Duration
+	average       time.Duration
+	stdDev        time.Duration
+	percentiles   []percentile
+	histogram     []histogramBucket
+	// resources used by the successful attempts, nil if none were measured
+	resources *resourceStats
+	// hunt of the run, nil if not hunting
+	hunt *huntReport
+	// outputGroups of the distinct outputs, nil if not grouping
+	outputGroups *outputGroupStats
+	// estimated is true if percentiles and histogram are estimated by a sketch
+	estimated bool
+	// combinations holds the statistics per combination of a matrix run
+	combinations []combinationStats
+	Results      []Result `json:"results"`
+}
+
+// isFailure returns true if the task failed, either by error or by timing out
+func (r *Result) isFailure() bool {
+	return r.IsError || r.IsTimeout
 }
 
 // Write implements io.Writer to get the output of the command for
@@ -46,21 +109,65 @@ func (r *Result) Write(p []byte) (n int, err error) {
 }
 
 func (c *configuredOper) calcStats() statistics {
-	tot := time.Duration(0)
-	n := len(c.results)
+	n := c.amResults()
 	if n == 0 {
 		return statistics{}
 	}
+	am := c.am
+	if c.timeBounded() {
+		am = n
+	}
+	var s statistics
+	if c.lowMemory {
+		s = c.agg.statistics(am)
+	} else {
+		s = c.calcResultStats(c.results, am)
+	}
+	s.haltReason = c.haltReason
+	// In-flight tasks are cancelled when halting, but the run itself is halted
+	s.cancelled = c.wasCancelled && c.haltReason == ""
+	s.runtime = c.runtime
+	s.hunt = c.hunt.summary()
+	s.outputGroups = c.outputGroups.stats()
+	s.Results = c.results
+	if c.params != nil && c.params.isMatrix() {
+		s.combinations = c.calcCombinationStats()
+	}
+	return s
+}
+
+// calcResultStats of the results, out of am requested tasks
+func (c *configuredOper) calcResultStats(results []Result, am int) statistics {
+	tot := time.Duration(0)
+	n := len(results)
+	if n == 0 {
+		return statistics{am: am}
+	}
 	minDur := time.Duration(9223372036854775807)
 	maxDur := time.Duration(-9223372036854775808)
 	amFails := 0
 	amCancelled := 0
+	amTimeouts := 0
+	amRetried := 0
+	amFailedTasks := 0
 	var min, max Result
-	for _, r := range c.results {
+	successes := make([]Result, 0, n)
+	for _, r := range results {
+		// Every task which needed a retry has exactly one second attempt
+		if r.Attempt == 2 {
+			amRetried++
+		}
+		if r.isFailure() && !c.retry.shouldRetry(r.Attempt) {
+			amFailedTasks++
+		}
 		if r.IsCancelled {
 			amCancelled++
 			continue
 		}
+		if r.IsTimeout {
+			amTimeouts++
+			continue
+		}
 		if r.IsError {
 			amFails++
 			continue
@@ -74,28 +181,46 @@ func (c *configuredOper) calcStats() statistics {
 			maxDur = r.Runtime
 		}
 		tot += r.Runtime
+		successes = append(successes, r)
 	}
 
-	avr := int64(tot) / int64(n)
-	varSum := 0.0
-	for _, x := range c.results {
-		varSum += math.Pow((float64(x.Runtime) - float64(avr)), 2.0)
+	// The average and std deviation are of the successful attempts only, same as the
+	// aggregator calculates them
+	avr := 0.0
+	stdDeviation := time.Duration(0)
+	if len(successes) > 0 {
+		avr = float64(tot) / float64(len(successes))
+		varSum := 0.0
+		for _, x := range successes {
+			varSum += math.Pow(float64(x.Runtime)-avr, 2.0)
+		}
+		variance := varSum / float64(len(successes))
+		stdDeviation = time.Duration(int64(math.Sqrt(variance)))
+	}
+	sorted := sortedRuntimes(results)
+	// Tasks only exhaust their attempts if they may be retried
+	amExhausted := 0
+	if c.retry.enabled() {
+		amExhausted = amFailedTasks
 	}
-	variance := varSum / float64(n)
-	stdDeviation := time.Duration(int64(math.Sqrt(variance)))
 	return statistics{
-		am:          c.am,
-		amDone:      n,
-		amFails:     amFails,
-		amCancelled: amCancelled,
-		cancelled:   c.wasCancelled,
-		runtime:     c.runtime,
-		min:         min,
-		max:         max,
-		total:       tot,
-		average:     time.Duration(avr),
-		stdDev:      stdDeviation,
-		Results:     c.results,
+		am:            am,
+		amDone:        n,
+		amFails:       amFails,
+		amCancelled:   amCancelled,
+		amTimeouts:    amTimeouts,
+		amRetried:     amRetried,
+		amExhausted:   amExhausted,
+		amFailedTasks: amFailedTasks,
+		retries:       c.retry.enabled(),
+		min:           min,
+		max:           max,
+		total:         tot,
+		average:       time.Duration(avr),
+		stdDev:        stdDeviation,
+		percentiles:   calcPercentiles(sorted),
+		histogram:     c.histogram.histogram(sorted),
+		resources:     calcResourceStats(results),
 	}
 }
 
@@ -104,17 +229,107 @@ func (s *statistics) String() string {
 	if s.cancelled {
 		state = " (cancelled)"
 	}
+	if s.haltReason != "" {
+		state = fmt.Sprintf(" (halted: %v)", s.haltReason)
+	}
+	retries := ""
+	if s.retries {
+		retries = fmt.Sprintf("Amount of tasks retried: %v, amount of tasks which exhausted their attempts: %v,\n", s.amRetried, s.amExhausted)
+	}
 	return fmt.Sprintf(`
 == Statistics ==
-Amount of repitions: %v, completed: %v, amount of failures: %v, amount of cancelled: %v%s,
-The following is calculated on successful attempts:
+Amount of repitions: %v, completed: %v, amount of failures: %v, amount of timeouts: %v, amount of cancelled: %v%s,
+%sThe following is calculated on successful attempts:
   Runtime: %s, Total routine work time: %v,
   Average time per task: %v, Std deviation: %v
   Max time, index: %v, time: %v
-  Min time, index: %v, time: %v`,
-		s.am, s.amDone, s.amFails, s.amCancelled, state,
+  Min time, index: %v, time: %v
+  Percentiles%v, %v`,
+		s.am, s.amDone, s.amFails, s.amTimeouts, s.amCancelled, state,
+		retries,
 		s.runtime, s.total,
 		s.average, s.stdDev,
 		s.max.Idx, s.max.Runtime,
-		s.min.Idx, s.min.Runtime)
+		s.min.Idx, s.min.Runtime,
+		estimatedString(s.estimated), percentilesString(s.percentiles)) + resourcesString(s.resources, s.estimated) + histogramString(s.histogram) + s.combinationsString() + outputGroupsString(s.outputGroups) + huntString(s.hunt)
+}
+
+const (
+	statisticsFormatText = "text"
+	statisticsFormatJSON = "json"
+)
+
+// statisticsSummary is the machine-readable form of the statistics. Durations are in
+// nanoseconds, same as the runtime of each Result.
+type statisticsSummary struct {
+	Combination string `json:"combination,omitempty"`
+	Requested   int    `json:"requested"`
+	Completed   int    `json:"completed"`
+	Failures    int    `json:"failures"`
+	Timeouts    int    `json:"timeouts"`
+	Cancelled   int    `json:"cancelled"`
+	Retried     int    `json:"retried"`
+	Exhausted   int    `json:"exhausted"`
+	// FailedTasks which failed on their final attempt
+	FailedTasks  int                 `json:"failedTasks"`
+	WasCancelled bool                `json:"wasCancelled"`
+	HaltReason   string              `json:"haltReason,omitempty"`
+	Runtime      time.Duration       `json:"runtime"`
+	Total        time.Duration       `json:"total"`
+	Average      time.Duration       `json:"average"`
+	StdDev       time.Duration       `json:"stdDev"`
+	Min          time.Duration       `json:"min"`
+	Max          time.Duration       `json:"max"`
+	Percentiles  []percentile        `json:"percentiles"`
+	Estimated    bool                `json:"estimated"`
+	Histogram    []histogramBucket   `json:"histogram"`
+	Resources    *resourceStats      `json:"resources,omitempty"`
+	Hunt         *huntReport         `json:"hunt,omitempty"`
+	OutputGroups *outputGroupStats   `json:"outputGroups,omitempty"`
+	Combinations []statisticsSummary `json:"combinations,omitempty"`
+}
+
+func (s *statistics) summary() statisticsSummary {
+	ret := statisticsSummary{
+		Requested:    s.am,
+		Completed:    s.amDone,
+		Failures:     s.amFails,
+		Timeouts:     s.amTimeouts,
+		Cancelled:    s.amCancelled,
+		Retried:      s.amRetried,
+		Exhausted:    s.amExhausted,
+		FailedTasks:  s.amFailedTasks,
+		WasCancelled: s.cancelled,
+		HaltReason:   s.haltReason,
+		Runtime:      s.runtime,
+		Total:        s.total,
+		Average:      s.average,
+		StdDev:       s.stdDev,
+		Min:          s.min.Runtime,
+		Max:          s.max.Runtime,
+		Percentiles:  s.percentiles,
+		Estimated:    s.estimated,
+		Histogram:    s.histogram,
+		Resources:    s.resources,
+		Hunt:         s.hunt,
+		OutputGroups: s.outputGroups,
+	}
+	for _, cs := range s.combinations {
+		combination := cs.summary()
+		combination.Combination = cs.name
+		ret.Combinations = append(ret.Combinations, combination)
+	}
+	return ret
+}
+
+// format the statistics as one of ['text', 'json']
+func (s *statistics) format(format string) string {
+	if format != statisticsFormatJSON {
+		return s.String()
+	}
+	b, err := json.MarshalIndent(s.summary(), "", "  ")
+	if err != nil {
+		return fmt.Sprintf("failed to marshal statistics: %v", err)
+	}
+	return string(b)
 }
@@ -86,6 +86,28 @@ func TestCalcStats_separatesFailuresFromCancelled(t *testing.T) {
 	}
 }
 
+func TestCalcStats_separatesTimeoutsFromFailures(t *testing.T) {
+	results := []Result{
+		{Idx: 1, Runtime: 10 * time.Second},
+		{Idx: 2, Runtime: 20 * time.Second, IsError: true},
+		{Idx: 3, Runtime: 30 * time.Second, IsTimeout: true},
+	}
+	c := configuredOper{am: 3, results: results}
+	stats := c.calcStats()
+	if stats.amFails != 1 {
+		t.Fatalf("expected 1 failure, got %d", stats.amFails)
+	}
+	if stats.amTimeouts != 1 {
+		t.Fatalf("expected 1 timeout, got %d", stats.amTimeouts)
+	}
+	if stats.max.Idx != 1 {
+		t.Fatalf("expected timeouts to be excluded from runtime statistics, got max index: %d", stats.max.Idx)
+	}
+	if !strings.Contains(stats.String(), "amount of timeouts: 1") {
+		t.Fatalf("expected timeout count in statistics string, got: %s", stats.String())
+	}
+}
+
 func TestStatisticsString_reportsCompletedAndCancelled(t *testing.T) {
 	stats := statistics{am: 3, amDone: 1, amFails: 1, amCancelled: 1, cancelled: true}
 	got := stats.String()
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type successMode string
+
+const (
+	// successAll requires every rule to pass
+	successAll successMode = "all"
+	// successAny requires at least one rule to pass
+	successAny successMode = "any"
+)
+
+// successRule checks one aspect of an attempt. It returns a description of the outcome,
+// such as 'exit code: 1, not in: [0 2]', and whether it passed.
+type successRule func(res *Result, exitCode int) (string, bool)
+
+// successCriteria decides whether an attempt which ran to completion succeeded, in place
+// of only checking that its exit code is 0
+type successCriteria struct {
+	mode  successMode
+	rules []successRule
+	desc  []string
+}
+
+// parseSuccessCriteria of the rules which are set. With successAll, the exit code rule is
+// always included, and defaults to only allowing 0. With successAny, it's only included if
+// okExit is set, as a default exit code of 0 would otherwise pass regardless of the other
+// rules. Returns nil if no rule is set, so that any exit code other than 0 is a failure,
+// as without criteria.
+func parseSuccessCriteria(okExit, stdoutMatch, stdoutNotMatch string, stderrEmpty bool, maxRuntime time.Duration, mode string) (*successCriteria, error) {
+	sc := &successCriteria{mode: successMode(mode)}
+	switch sc.mode {
+	case "":
+		sc.mode = successAll
+	case successAll, successAny:
+	default:
+		return nil, fmt.Errorf("unrecognized okMode: %q, options are: ['%v', '%v']", mode, successAll, successAny)
+	}
+	if maxRuntime < 0 {
+		return nil, fmt.Errorf("okMaxRuntime must be positive, got: %v", maxRuntime)
+	}
+	if okExit == "" && stdoutMatch == "" && stdoutNotMatch == "" && !stderrEmpty && maxRuntime == 0 {
+		return nil, nil
+	}
+
+	okExitCodes := []int{0}
+	if okExit == "" && sc.mode == successAny {
+		okExitCodes = nil
+	}
+	if okExit != "" {
+		okExitCodes = nil
+		for _, codeStr := range strings.Split(okExit, ",") {
+			code, err := strconv.Atoi(strings.TrimSpace(codeStr))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse okExit: %q, expected exit codes such as '0,2': %w", okExit, err)
+			}
+			okExitCodes = append(okExitCodes, code)
+		}
+	}
+	if okExitCodes != nil {
+		sc.add(fmt.Sprintf("exit code in: %v", okExitCodes), func(_ *Result, exitCode int) (string, bool) {
+			if slices.Contains(okExitCodes, exitCode) {
+				return fmt.Sprintf("exit code: %v, in: %v", exitCode, okExitCodes), true
+			}
+			return fmt.Sprintf("exit code: %v, not in: %v", exitCode, okExitCodes), false
+		})
+	}
+
+	if stdoutMatch != "" {
+		re, err := regexp.Compile(stdoutMatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile okStdoutMatch: %w", err)
+		}
+		sc.add(fmt.Sprintf("stdout matches: %q", re), func(res *Result, _ int) (string, bool) {
+			if re.MatchString(eventsText(res.Stdout)) {
+				return fmt.Sprintf("stdout matches: %q", re), true
+			}
+			return fmt.Sprintf("stdout doesn't match: %q", re), false
+		})
+	}
+	if stdoutNotMatch != "" {
+		re, err := regexp.Compile(stdoutNotMatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile okStdoutNotMatch: %w", err)
+		}
+		sc.add(fmt.Sprintf("stdout doesn't match: %q", re), func(res *Result, _ int) (string, bool) {
+			if re.MatchString(eventsText(res.Stdout)) {
+				return fmt.Sprintf("stdout matches: %q", re), false
+			}
+			return fmt.Sprintf("stdout doesn't match: %q", re), true
+		})
+	}
+	if stderrEmpty {
+		sc.add("stderr is empty", func(res *Result, _ int) (string, bool) {
+			if eventsText(res.Stderr) == "" {
+				return "stderr is empty", true
+			}
+			return "stderr isn't empty", false
+		})
+	}
+	if maxRuntime > 0 {
+		sc.add(fmt.Sprintf("runtime within: %v", maxRuntime), func(res *Result, _ int) (string, bool) {
+			if res.Runtime <= maxRuntime {
+				return fmt.Sprintf("runtime: %v, within: %v", res.Runtime, maxRuntime), true
+			}
+			return fmt.Sprintf("runtime: %v, exceeds: %v", res.Runtime, maxRuntime), false
+		})
+	}
+	return sc, nil
+}
+
+func (sc *successCriteria) add(desc string, rule successRule) {
+	sc.desc = append(sc.desc, desc)
+	sc.rules = append(sc.rules, rule)
+}
+
+func (sc *successCriteria) String() string {
+	if sc == nil {
+		return "exit code 0"
+	}
+	return fmt.Sprintf("%v of [%v]", sc.mode, strings.Join(sc.desc, ", "))
+}
+
+// evaluate the attempt which ran to completion with runErr. Returns the rule which decided
+// the outcome, and an error if the attempt failed. Errors other than exit codes, such as
+// the command not being found, are failures regardless of the rules.
+func (sc *successCriteria) evaluate(res *Result, runErr error) (string, error) {
+	exitCode := 0
+	if runErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(runErr, &exitErr) {
+			return "", runErr
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	var passed, failed []string
+	for _, rule := range sc.rules {
+		outcome, ok := rule(res, exitCode)
+		if ok {
+			passed = append(passed, outcome)
+		} else {
+			failed = append(failed, outcome)
+		}
+		// Stop at the first rule which decides the outcome
+		if sc.mode == successAll && !ok {
+			return outcome, fmt.Errorf("success criteria not met, %v", outcome)
+		}
+		if sc.mode == successAny && ok {
+			return outcome, nil
+		}
+	}
+	if sc.mode == successAny {
+		rule := strings.Join(failed, " and ")
+		return rule, fmt.Errorf("success criteria not met, %v", rule)
+	}
+	return strings.Join(passed, " and "), nil
+}
+
+// eventsText of the output events of one stream
+func eventsText(events []OutputEvent) string {
+	var sb strings.Builder
+	for _, e := range events {
+		sb.WriteString(e.Text)
+	}
+	return sb.String()
+}
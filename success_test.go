@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_parseSuccessCriteria(t *testing.T) {
+	sc, err := parseSuccessCriteria("", "", "", false, 0, "")
+	if err != nil || sc != nil {
+		t.Fatalf("expected no criteria, got: %v, err: %v", sc, err)
+	}
+	for _, tc := range []struct {
+		name           string
+		okExit         string
+		stdoutMatch    string
+		stdoutNotMatch string
+		maxRuntime     time.Duration
+		mode           string
+	}{
+		{name: "bad exit code", okExit: "0,two"},
+		{name: "bad match", stdoutMatch: "("},
+		{name: "bad not match", stdoutNotMatch: "("},
+		{name: "negative runtime", maxRuntime: -time.Second},
+		{name: "bad mode", okExit: "0", mode: "some"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseSuccessCriteria(tc.okExit, tc.stdoutMatch, tc.stdoutNotMatch, false, tc.maxRuntime, tc.mode)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+		})
+	}
+}
+
+func Test_successCriteria_evaluate(t *testing.T) {
+	exitErr := func(t *testing.T, code int) error {
+		t.Helper()
+		cmdErr := exec.Command("sh", "-c", fmt.Sprintf("exit %v", code)).Run()
+		if cmdErr == nil {
+			t.Fatalf("expected exit error for code: %v", code)
+		}
+		return cmdErr
+	}
+	stdout := func(s string) *Result {
+		return &Result{Stdout: []OutputEvent{{Text: s}}, Runtime: time.Millisecond}
+	}
+
+	t.Run("allowed exit codes", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("0,2", "", "", false, 0, "")
+		rule, err := sc.evaluate(stdout(""), exitErr(t, 2))
+		if err != nil {
+			t.Fatalf("expected exit code 2 to succeed, got: %v", err)
+		}
+		if rule != "exit code: 2, in: [0 2]" {
+			t.Fatalf("unexpected rule: %q", rule)
+		}
+		rule, err = sc.evaluate(stdout(""), exitErr(t, 1))
+		if err == nil || rule != "exit code: 1, not in: [0 2]" {
+			t.Fatalf("expected exit code 1 to fail, got rule: %q, err: %v", rule, err)
+		}
+	})
+
+	t.Run("all", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("", "ok", "ERROR", true, 0, "")
+		if _, err := sc.evaluate(stdout("ok"), nil); err != nil {
+			t.Fatalf("expected success, got: %v", err)
+		}
+		rule, err := sc.evaluate(stdout("ok ERROR"), nil)
+		if err == nil || rule != `stdout matches: "ERROR"` {
+			t.Fatalf("expected the not match rule to decide, got rule: %q, err: %v", rule, err)
+		}
+		res := stdout("ok")
+		res.Stderr = []OutputEvent{{Text: "warning"}}
+		rule, err = sc.evaluate(res, nil)
+		if err == nil || rule != "stderr isn't empty" {
+			t.Fatalf("expected the stderr rule to decide, got rule: %q, err: %v", rule, err)
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("0", "already exists", "", false, 0, "any")
+		rule, err := sc.evaluate(stdout("already exists"), exitErr(t, 1))
+		if err != nil || rule != `stdout matches: "already exists"` {
+			t.Fatalf("expected the match rule to decide, got rule: %q, err: %v", rule, err)
+		}
+		rule, err = sc.evaluate(stdout("nope"), exitErr(t, 1))
+		if err == nil || !strings.Contains(rule, "exit code: 1") || !strings.Contains(rule, "doesn't match") {
+			t.Fatalf("expected every rule to be recorded on failure, got rule: %q, err: %v", rule, err)
+		}
+	})
+
+	t.Run("any without okExit", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("", "ok", "", true, 0, "any")
+		res := stdout("FAIL")
+		res.Stderr = []OutputEvent{{Text: "error"}}
+		rule, err := sc.evaluate(res, nil)
+		if err == nil || strings.Contains(rule, "exit code") {
+			t.Fatalf("expected exit code 0 to not pass on its own, got rule: %q, err: %v", rule, err)
+		}
+		if _, err := sc.evaluate(stdout("ok"), exitErr(t, 1)); err != nil {
+			t.Fatalf("expected the stdout rule to pass regardless of exit code, got: %v", err)
+		}
+	})
+
+	t.Run("max runtime", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("", "", "", false, 10*time.Millisecond, "")
+		res := stdout("")
+		res.Runtime = time.Second
+		if _, err := sc.evaluate(res, nil); err == nil {
+			t.Fatal("expected slow attempt to fail")
+		}
+	})
+
+	t.Run("errors other than exit codes", func(t *testing.T) {
+		sc, _ := parseSuccessCriteria("0,1", "", "", false, 0, "any")
+		want := errors.New("executable not found")
+		if _, err := sc.evaluate(stdout(""), want); !errors.Is(err, want) {
+			t.Fatalf("expected: %v, got: %v", want, err)
+		}
+	})
+}
+
+func Test_configuredOper_run_success(t *testing.T) {
+	sc, err := parseSuccessCriteria("", "", "FAIL", false, 0, "")
+	if err != nil {
+		t.Fatalf("failed to parse criteria: %v", err)
+	}
+	// Even tasks print FAIL, but exit 0
+	c := configuredOper{
+		am:            4,
+		args:          []string{"sh", "-c", `[ $((REPEATER_TASK_IDX % 2)) -eq 0 ] && echo FAIL; exit 0`},
+		success:       sc,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if stats.amFails != 2 {
+		t.Fatalf("expected: 2 failures, got: %v", stats.amFails)
+	}
+	for _, res := range stats.Results {
+		if res.IsError != (res.Idx%2 == 0) {
+			t.Fatalf("expected task: %v to have isError: %v", res.Idx, res.Idx%2 == 0)
+		}
+		if res.Rule == "" {
+			t.Fatal("expected the deciding rule to be recorded")
+		}
+	}
+}
+
+func Test_configuredOper_run_successAny(t *testing.T) {
+	sc, err := parseSuccessCriteria("", "ok", "", false, 0, "any")
+	if err != nil {
+		t.Fatalf("failed to parse criteria: %v", err)
+	}
+	// Exits 0, but fails its only stdout rule
+	c := configuredOper{
+		am:            1,
+		args:          []string{"sh", "-c", "echo FAIL; exit 0"},
+		success:       sc,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	if stats.amFails != 1 {
+		t.Fatalf("expected: 1 failure, got: %v", stats.amFails)
+	}
+	if rule := stats.Results[0].Rule; rule != `stdout doesn't match: "ok"` {
+		t.Fatalf("expected the stdout rule to decide, got: %q", rule)
+	}
+}
+
+func Test_configuredOper_New_success(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{okExit: "zero", okMode: "some"})
+	if err == nil || !strings.Contains(err.Error(), "okMode") {
+		t.Fatalf("expected error for bad okMode, got: %v", err)
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{okExit: "0,3"})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.success == nil {
+		t.Fatal("expected success criteria to be set")
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultTagFormat of the tag which prefixes each output line, such as '[w3 #142]'
+const DefaultTagFormat = "[w{{.WorkerID}} #{{.Idx}}]"
+
+// workerColors which the tags are colored by, picked by worker. Red is left out, as it's
+// used for errors.
+var workerColors = []colorCode{CYAN, MAGENTA, BLUE, YELLOW, GREEN}
+
+// parseTagTemplate of the tag. It may contain the same placeholders as the arguments.
+func parseTagTemplate(format string, params *paramTable) (*template.Template, error) {
+	tmpls, err := parseArgTemplates([]string{format}, params, false)
+	if err != nil {
+		return nil, fmt.Errorf("tagFormat: %w", err)
+	}
+	return tmpls[0], nil
+}
+
+// taskTag expands the tag of the task, colored by worker if tagColor is set
+func (c *configuredOper) taskTag(taskIdx, workerID, attempt int) (string, error) {
+	values, err := executeTemplates([]*template.Template{c.tagTemplate}, c.templateData(taskIdx, workerID, attempt))
+	if err != nil {
+		return "", fmt.Errorf("failed to execute tagFormat template: %w", err)
+	}
+	values = c.replaceIncrement(values, taskIdx)
+	values = c.replaceLinePlaceholder(values, taskIdx, nil)
+	if c.params != nil {
+		values = c.params.replace(values, taskIdx, nil)
+	}
+	tag := values[0]
+	if c.tagColor && useColor {
+		tag = coloredMessage(workerColors[workerID%len(workerColors)], tag)
+	}
+	return tag, nil
+}
+
+// lineTagger prefixes each line of the output with the tag. Partial lines are buffered
+// per stream until they're completed, so that lines of stdout and stderr aren't mixed.
+// Stdout and stderr may be written concurrently.
+type lineTagger struct {
+	mu      sync.Mutex
+	tag     string
+	partial map[outputStream][]byte
+	tagged  strings.Builder
+}
+
+func newLineTagger(tag string) *lineTagger {
+	return &lineTagger{
+		tag:     tag,
+		partial: make(map[outputStream][]byte),
+	}
+}
+
+func (lt *lineTagger) write(stream outputStream, p []byte) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	buf := p
+	if partial := lt.partial[stream]; len(partial) > 0 {
+		buf = append(partial, p...)
+	}
+	off := 0
+	for {
+		lineEnd := bytes.IndexByte(buf[off:], '\n')
+		if lineEnd == -1 {
+			break
+		}
+		lt.writeLine(buf[off : off+lineEnd])
+		off += lineEnd + 1
+	}
+	// Copy only the trailing partial line, as p may be reused by the caller
+	lt.partial[stream] = append(lt.partial[stream][:0], buf[off:]...)
+}
+
+func (lt *lineTagger) writeLine(line []byte) {
+	lt.tagged.WriteString(lt.tag)
+	lt.tagged.WriteByte(' ')
+	lt.tagged.Write(line)
+	lt.tagged.WriteByte('\n')
+}
+
+// finish by tagging the partial lines which were never completed, and returning the
+// tagged output. The error of the task, if any, is tagged as the first line, same as
+// it's prepended to the output.
+func (lt *lineTagger) finish(taskErr error) string {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	for _, stream := range []outputStream{stdoutStream, stderrStream} {
+		if len(lt.partial[stream]) > 0 {
+			lt.writeLine(lt.partial[stream])
+			delete(lt.partial, stream)
+		}
+	}
+	if taskErr == nil {
+		return lt.tagged.String()
+	}
+	return lt.tag + " " + taskErr.Error() + "\n" + lt.tagged.String()
+}
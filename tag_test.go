@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_lineTagger(t *testing.T) {
+	t.Run("partial lines are buffered per stream", func(t *testing.T) {
+		lt := newLineTagger("[t]")
+		lt.write(stdoutStream, []byte("hel"))
+		lt.write(stderrStream, []byte("warn"))
+		lt.write(stdoutStream, []byte("lo\nwor"))
+		lt.write(stderrStream, []byte("ing\n"))
+		lt.write(stdoutStream, []byte("ld"))
+		want := "[t] hello\n[t] warning\n[t] world\n"
+		if got := lt.finish(nil); got != want {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+
+	t.Run("several lines in one write", func(t *testing.T) {
+		lt := newLineTagger("[t]")
+		lt.write(stdoutStream, []byte("a\n\nb\n"))
+		want := "[t] a\n[t] \n[t] b\n"
+		if got := lt.finish(nil); got != want {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+
+	t.Run("the written buffer may be reused", func(t *testing.T) {
+		lt := newLineTagger("[t]")
+		p := []byte("a\nb")
+		lt.write(stdoutStream, p)
+		copy(p, "x\ny")
+		lt.write(stdoutStream, []byte("c\n"))
+		want := "[t] a\n[t] bc\n"
+		if got := lt.finish(nil); got != want {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+
+	t.Run("many lines in chunks", func(t *testing.T) {
+		lt := newLineTagger("[t]")
+		text := strings.Repeat("line\n", 100_000)
+		for i := 0; i < len(text); i += 7 {
+			lt.write(stdoutStream, []byte(text[i:min(i+7, len(text))]))
+		}
+		if got := lt.finish(nil); got != strings.Repeat("[t] line\n", 100_000) {
+			t.Fatalf("expected every line to be tagged once, got: %v bytes", len(got))
+		}
+	})
+
+	t.Run("error is the first line", func(t *testing.T) {
+		lt := newLineTagger("[t]")
+		lt.write(stdoutStream, []byte("out\n"))
+		want := "[t] exit status 1\n[t] out\n"
+		if got := lt.finish(errors.New("exit status 1")); got != want {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+}
+
+func Test_configuredOper_taskTag(t *testing.T) {
+	tmpl, err := parseTagTemplate(DefaultTagFormat, nil)
+	if err != nil {
+		t.Fatalf("failed to parse tag: %v", err)
+	}
+	c := configuredOper{tagTemplate: tmpl}
+	got, err := c.taskTag(142, 3, 1)
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if got != "[w3 #142]" {
+		t.Fatalf("expected: %q, got: %q", "[w3 #142]", got)
+	}
+
+	orig := useColor
+	t.Cleanup(func() { useColor = orig })
+	useColor = true
+	c.tagColor = true
+	got, _ = c.taskTag(142, 3, 1)
+	if want := coloredMessage(workerColors[3], "[w3 #142]"); got != want {
+		t.Fatalf("expected: %q, got: %q", want, got)
+	}
+}
+
+func Test_configuredOper_run_tag(t *testing.T) {
+	tmpl, err := parseTagTemplate("#{{.Idx}}", nil)
+	if err != nil {
+		t.Fatalf("failed to parse tag: %v", err)
+	}
+	c := configuredOper{
+		am:            2,
+		args:          []string{"sh", "-c", `printf "a\nb"; echo c >&2`},
+		tagTemplate:   tmpl,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	for _, res := range stats.Results {
+		if strings.Contains(res.Output, "#") {
+			t.Fatalf("expected the output of the result to be untagged, got: %q", res.Output)
+		}
+	}
+
+	res := c.doWork(context.Background(), 0, 7, 1, nil)
+	lines := strings.Split(strings.TrimSuffix(res.taggedOutput, "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 tagged lines, got: %q", res.taggedOutput)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#7 ") {
+			t.Fatalf("expected each line to be tagged, got: %q", line)
+		}
+	}
+}
+
+func Test_configuredOper_New_tag(t *testing.T) {
+	_, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV2, "", "", false, "", false, false, runOptions{tag: true})
+	if err == nil {
+		t.Fatal("expected error as tag requires output format v1, got nil")
+	}
+	_, err = New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{tag: true, tagFormat: "{{.Missing}}"})
+	if err == nil || !strings.Contains(err.Error(), "tagFormat") {
+		t.Fatalf("expected error for unknown field of tagFormat, got: %v", err)
+	}
+	c, err := New(1, 1, []string{"true"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{tag: true})
+	if err != nil {
+		t.Fatalf("expected nil, got: %v", err)
+	}
+	if c.tagTemplate == nil {
+		t.Fatal("expected the default tag to be set")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// taskTemplateData is available to argument templates, such as '{{.Idx}}'
+type taskTemplateData struct {
+	// Idx of the task, same as the INC placeholder
+	Idx int
+	// WorkerID of the worker running the task
+	WorkerID int
+	// Attempt of the task, starting at 1
+	Attempt int
+	// Rand is a random number, derived from the seed of the run and the task index,
+	// so that it's the same for every attempt of a task
+	Rand int64
+	// UUID is a version 4 UUID, derived in the same way as Rand
+	UUID string
+	// Start of the run
+	Start time.Time
+	// Line of the task, if input is set
+	Line string
+	// Params of the task, if params or matrix is set
+	Params map[string]string
+}
+
+var templateIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"pad":          pad,
+		shellQuoteFunc: shellQuote,
+		"add":          func(a, b int) int { return a + b },
+		"sub":          func(a, b int) int { return a - b },
+		"mul":          func(a, b int) int { return a * b },
+		"mod": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("mod by zero")
+			}
+			return a % b, nil
+		},
+	}
+}
+
+// pad v with leading zeros to the width, such as 'pad 5 42' -> '00042'
+func pad(width int, v any) string {
+	switch n := v.(type) {
+	case int, int64:
+		return fmt.Sprintf("%0*d", width, n)
+	}
+	s := fmt.Sprint(v)
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
+
+// parseArgTemplates into one template per argument. Each param column which is a valid
+// identifier is added as a function which returns its own placeholder, so that '{{column}}'
+// is left for replaceParams. This way, param values are never parsed as templates.
+// If quote is set, the output of each action is quoted for the shell.
+func parseArgTemplates(args []string, params *paramTable, quote bool) ([]*template.Template, error) {
+	funcs := templateFuncs()
+	paramFuncs := make(map[string]bool)
+	if params != nil {
+		for _, col := range params.columns {
+			if !templateIdentifier.MatchString(col) {
+				continue
+			}
+			placeholder := paramPlaceholder(col)
+			funcs[col] = func() string { return placeholder }
+			// The placeholder is quoted once replaced
+			paramFuncs[col] = true
+		}
+	}
+	tmpls := make([]*template.Template, 0, len(args))
+	for i, arg := range args {
+		tmpl, err := template.New(fmt.Sprintf("arg%v", i)).
+			Option("missingkey=error").
+			Funcs(funcs).
+			Parse(arg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse argument: %q as template: %w", arg, err)
+		}
+		if quote {
+			quoteTemplateActions(tmpl, paramFuncs)
+		}
+		tmpls = append(tmpls, tmpl)
+	}
+	return tmpls, nil
+}
+
+// templateData of the task
+func (c *configuredOper) templateData(taskIdx, workerID, attempt int) taskTemplateData {
+	r := c.taskRand(taskIdx)
+	d := taskTemplateData{
+		Idx:      taskIdx,
+		WorkerID: workerID,
+		Attempt:  attempt,
+		Rand:     r.Int63(),
+		UUID:     uuidV4(r),
+		Start:    c.startedAt,
+	}
+	if c.lines != nil {
+		d.Line = c.lines[taskIdx]
+	}
+	if c.params != nil {
+		d.Params = c.params.values(taskIdx)
+	}
+	return d
+}
+
+// taskRand returns a random source which is deterministic for the seed and task index
+func (c *configuredOper) taskRand(taskIdx int) *rand.Rand {
+	// Spread the task indices so that neighbouring tasks don't get neighbouring seeds
+	return rand.New(rand.NewSource(c.seed ^ (int64(taskIdx)+1)*0x5DEECE66D))
+}
+
+func uuidV4(r *rand.Rand) string {
+	var b [16]byte
+	r.Read(b[:])
+	return formatUUIDv4(b)
+}
+
+// formatUUIDv4 by setting the version and variant bits of the random bytes
+func formatUUIDv4(b [16]byte) string {
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// executeArgTemplates of the task. If there are no templates, the arguments are returned as is.
+func (c *configuredOper) executeArgTemplates(taskIdx, workerID, attempt int) ([]string, error) {
+	if c.argTemplates == nil {
+		return c.args[1:], nil
+	}
+	ret, err := executeTemplates(c.argTemplates, c.templateData(taskIdx, workerID, attempt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute argument template: %w", err)
+	}
+	return ret, nil
+}
+
+func executeTemplates(tmpls []*template.Template, data taskTemplateData) ([]string, error) {
+	ret := make([]string, 0, len(tmpls))
+	var sb strings.Builder
+	for _, tmpl := range tmpls {
+		sb.Reset()
+		if err := tmpl.Execute(&sb, data); err != nil {
+			return nil, err
+		}
+		ret = append(ret, sb.String())
+	}
+	return ret, nil
+}
+
+// templateString of the template as it was given, or 'none' if it's not set
+func templateString(tmpl *template.Template) string {
+	if tmpl == nil {
+		return "none"
+	}
+	return tmpl.Root.String()
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/baalimago/repeater/internal/output"
+)
+
+func Test_pad(t *testing.T) {
+	testCases := []struct {
+		width int
+		given any
+		want  string
+	}{
+		{5, 42, "00042"},
+		{2, 123, "123"},
+		{4, "7", "0007"},
+		{3, int64(9), "009"},
+	}
+	for _, tc := range testCases {
+		if got := pad(tc.width, tc.given); got != tc.want {
+			t.Fatalf("for: pad %v %v, expected: %q, got: %q", tc.width, tc.given, tc.want, got)
+		}
+	}
+}
+
+func Test_configuredOper_executeArgTemplates(t *testing.T) {
+	newOper := func(t *testing.T, args []string, params *paramTable) configuredOper {
+		t.Helper()
+		tmpls, err := parseArgTemplates(args[1:], params, false)
+		if err != nil {
+			t.Fatalf("failed to parse templates: %v", err)
+		}
+		return configuredOper{args: args, argTemplates: tmpls, params: params, seed: 1}
+	}
+
+	t.Run("it should expose task metadata and helpers", func(t *testing.T) {
+		c := newOper(t, []string{"cmd", "{{.Idx}}", "{{pad 5 .Idx}}", "{{add .Idx 1000}}", "w{{.WorkerID}}-a{{.Attempt}}", "INCLUDE"}, nil)
+		got, err := c.executeArgTemplates(42, 3, 2)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		want := []string{"42", "00042", "1042", "w3-a2", "INCLUDE"}
+		if !slices.Equal(got, want) {
+			t.Fatalf("expected: %q, got: %q", want, got)
+		}
+	})
+
+	t.Run("it should derive random values from seed and task index", func(t *testing.T) {
+		c := newOper(t, []string{"cmd", "{{.Rand}}", "{{.UUID}}"}, nil)
+		first, _ := c.executeArgTemplates(1, 0, 1)
+		retry, _ := c.executeArgTemplates(1, 1, 2)
+		other, _ := c.executeArgTemplates(2, 0, 1)
+		if !slices.Equal(first, retry) {
+			t.Fatalf("expected same values for every attempt of a task, got: %q and %q", first, retry)
+		}
+		if first[0] == other[0] || first[1] == other[1] {
+			t.Fatalf("expected different values for different tasks, got: %q and %q", first, other)
+		}
+		uuidRe := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+		if !uuidRe.MatchString(first[1]) {
+			t.Fatalf("expected version 4 uuid, got: %q", first[1])
+		}
+	})
+
+	t.Run("it should leave param placeholders for replaceParams", func(t *testing.T) {
+		params := &paramTable{columns: []string{"user"}, rows: [][]string{{"{{.Idx}}"}}}
+		c := newOper(t, []string{"cmd", "{{user}}-{{.Params.user}}"}, params)
+		args, err := c.expandArgs(0, 0, 1)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		// The value is never parsed as a template when used as placeholder
+		if want := "{{.Idx}}-{{.Idx}}"; args[0] != want {
+			t.Fatalf("expected: %q, got: %q", want, args[0])
+		}
+	})
+
+	t.Run("it should work together with increment", func(t *testing.T) {
+		c := newOper(t, []string{"cmd", "INC-{{.Idx}}"}, nil)
+		c.increment = true
+		args, err := c.expandArgs(7, 0, 1)
+		if err != nil {
+			t.Fatalf("expected nil, got: %v", err)
+		}
+		if want := "7-7"; args[0] != want {
+			t.Fatalf("expected: %q, got: %q", want, args[0])
+		}
+	})
+}
+
+func Test_configuredOper_New_template(t *testing.T) {
+	for _, args := range [][]string{{"echo", "{{"}, {"echo", "{{.Nope}}"}, {"echo", "{{nope}}"}} {
+		_, err := New(1, 1, args, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{template: true})
+		if err == nil {
+			t.Fatalf("for args: %q, expected error, got nil", args)
+		}
+	}
+	_, err := New(1, 1, []string{"echo", "{{.Idx}}"}, output.HIDDEN, "testing", output.HIDDEN, outputFormatV1, "", "", false, "", false, false, runOptions{})
+	if err != nil {
+		t.Fatalf("expected arguments to be left as is without template, got: %v", err)
+	}
+}
+
+func Test_configuredOper_run_template(t *testing.T) {
+	args := []string{"printf", "%s", "{{pad 3 .Idx}}"}
+	tmpls, err := parseArgTemplates(args[1:], nil, false)
+	if err != nil {
+		t.Fatalf("failed to parse templates: %v", err)
+	}
+	c := configuredOper{
+		am:            3,
+		args:          args,
+		argTemplates:  tmpls,
+		amIdleWorkers: 1,
+		workPlanMu:    &sync.Mutex{},
+		workerWg:      &sync.WaitGroup{},
+	}
+	c.workerWg.Add(1)
+	stats := c.run(context.Background())
+	for _, r := range stats.Results {
+		if want := pad(3, r.Idx); r.Output != want {
+			t.Fatalf("expected: %q, got: %q", want, r.Output)
+		}
+	}
+}